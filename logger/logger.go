@@ -80,7 +80,7 @@ func SetRollingFile(fileDir, fileName string, maxNumber int32, maxSize int64, _u
 	if !logObj.isMustRename() {
 		//fmt.Println(fileDir + "/" + fileName)
 		logObj.logfile, _ = os.OpenFile(fileDir+"/"+fileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, os.ModePerm)
-		logObj.lg = log.New(logObj.logfile, "", log.Ldate|log.Ltime|log.Lshortfile)
+		logObj.lg = log.New(&redactWriter{logObj.logfile}, "", log.Ldate|log.Ltime|log.Lshortfile)
 	} else {
 		logObj.rename()
 	}
@@ -97,7 +97,7 @@ func SetRollingDaily(fileDir, fileName string) {
 
 	if !logObj.isMustRename() {
 		logObj.logfile, _ = os.OpenFile(fileDir+"/"+fileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, os.ModePerm)
-		logObj.lg = log.New(logObj.logfile, "", log.Ldate|log.Ltime)
+		logObj.lg = log.New(&redactWriter{logObj.logfile}, "", log.Ldate|log.Ltime)
 	} else {
 		logObj.rename()
 	}
@@ -105,7 +105,7 @@ func SetRollingDaily(fileDir, fileName string) {
 
 func console(s ...interface{}) {
 	if consoleAppender {
-		log.Println(s)
+		log.Println(s...)
 	}
 }
 
@@ -210,7 +210,7 @@ func (f *_FILE) rename() {
 			t, _ := time.Parse(DATEFORMAT, time.Now().Format(DATEFORMAT))
 			f._date = &t
 			f.logfile, _ = os.Create(f.dir + "/" + f.filename)
-			f.lg = log.New(logObj.logfile, "\n", log.Ldate|log.Ltime|log.Lshortfile)
+			f.lg = log.New(&redactWriter{logObj.logfile}, "\n", log.Ldate|log.Ltime|log.Lshortfile)
 		}
 	} else {
 		f.coverNextOne()
@@ -231,7 +231,7 @@ func (f *_FILE) coverNextOne() {
 	}
 	os.Rename(f.dir+"/"+f.filename, f.dir+"/"+f.filename+"."+strconv.Itoa(int(f._suffix)))
 	f.logfile, _ = os.Create(f.dir + "/" + f.filename)
-	f.lg = log.New(logObj.logfile, "\n", log.Ldate|log.Ltime|log.Lshortfile)
+	f.lg = log.New(&redactWriter{logObj.logfile}, "\n", log.Ldate|log.Ltime|log.Lshortfile)
 }
 
 func fileSize(file string) int64 {
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Shorter secrets are not redacted, they would mask common words of the log
+const MinSecretLen = 4
+
+const redactedText = "******"
+
+var secrets []string
+var secretsMu sync.RWMutex
+
+// writer of the log lines, the secrets are replaced
+type redactWriter struct {
+	w io.Writer
+}
+
+func init() {
+	log.SetOutput(&redactWriter{os.Stderr})
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write([]byte(Redact(string(p)))); nil != err {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/**
+* Add a resolved secret (password, secret file, credential command output), redacted in every log line
+ */
+func AddSecret(secret string) {
+	if len(secret) < MinSecretLen {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+/**
+* Replace the secrets in the text
+ */
+func Redact(text string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		text = strings.Replace(text, secret, redactedText, -1)
+	}
+	return text
+}
@@ -2,44 +2,211 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"struct_sync/common"
 	"struct_sync/service"
+	"syscall"
 	"time"
 )
 
 const
 	ConfName = "app.conf"
 
+// Directory of the config fragments beside the config file, merged in file name order
+const ConfDir = "conf.d"
 
-func ReadConf(confFile string) *service.GlobalSet {
-	if data, err := ioutil.ReadFile(confFile); err != nil {
-		return nil
-	} else {
-		gs := &service.GlobalSet{}
-		if err := json.Unmarshal(data, gs); err != nil {
-			fmt.Println("config file parser error: ", err)
+// Supported commands
+var Commands = []string{"sync", "export", "diff", "codegen", "docs", "diagram", "bundle", "apply"}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "  StructSync [command] [params]")
+	fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+	fmt.Fprintln(flag.CommandLine.Output(), "  sync      Sync the source struct to the dest databases (default)")
+	fmt.Fprintln(flag.CommandLine.Output(), "  export    Export the source schema to -o file, or -o dir with -split")
+	fmt.Fprintln(flag.CommandLine.Output(), "  diff      Print the adjust SQL from the -dest (-dest-ref or -to) schema to the source schema, or save it to -o file")
+	fmt.Fprintln(flag.CommandLine.Output(), "  codegen   Generate go model structs of the source schema to -o dir")
+	fmt.Fprintln(flag.CommandLine.Output(), "  docs      Generate the data dictionary (schema.md and index.html) of the source schema to -o dir")
+	fmt.Fprintln(flag.CommandLine.Output(), "  diagram   Print the ER diagram of the source schema, or save it to -o file")
+	fmt.Fprintln(flag.CommandLine.Output(), "  bundle    Package the changes of each dest db (or -dest / -dest-ref / -to) with the pre-state fingerprints to -o file.tar.gz")
+	fmt.Fprintln(flag.CommandLine.Output(), "  apply     Verify the -bundle and the pre-state of each dest db (or -to), then execute the changes")
+	fmt.Fprintln(flag.CommandLine.Output(), "Params:")
+	flag.PrintDefaults()
+}
+
+func inStringSlice(str string, strSli []string) bool {
+	for _, v := range strSli {
+		if str == v {
+			return true
+		}
+	}
+	return false
+}
+
+
+/**
+* Read the config file and the conf.d fragments beside it (*.conf, *.json).
+* The keys of a later file override the former ones, the DestDbList of the fragments are appended
+ */
+func ReadConf(confFile string) (*service.GlobalSet, error) {
+	fragments, err := filepath.Glob(filepath.Join(filepath.Dir(confFile), ConfDir, "*"))
+	if nil != err {
+		return nil, err
+	}
+	files := []string{confFile}
+	sort.Strings(fragments)
+	for _, file := range fragments {
+		if ext := filepath.Ext(file); ".conf" == ext || ".json" == ext {
+			files = append(files, file)
+		}
+	}
+
+	gs := &service.GlobalSet{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if nil != err {
+			return nil, err
+		}
+
+		dests := gs.DestDbList
+		gs.DestDbList = nil
+		if err := json.Unmarshal(data, gs); nil != err {
+			return nil, confError(file, data, err)
+		}
+		gs.DestDbList = append(dests, gs.DestDbList...)
+
+		// Unknown keys are ignored, most likely a typo
+		var raw interface{}
+		if nil == json.Unmarshal(data, &raw) {
+			for _, key := range unknownConfKeys(raw, reflect.TypeOf(service.GlobalSet{}), "") {
+				fmt.Fprintf(os.Stderr, "%s: unknown key %s ignored\n", file, key)
+			}
+		}
+	}
+	return gs, nil
+}
+
+/**
+* Keys of the json value without a field in the type, the field names match case-insensitively as encoding/json does,
+* ex: DestDbList.0.Hots
+ */
+func unknownConfKeys(value interface{}, t reflect.Type, prefix string) []string {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+
+	var unknown []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if reflect.Struct != t.Kind() {
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field, has := t.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, key) })
+			if !has || "" != field.PkgPath { // unexported fields are not decoded
+				unknown = append(unknown, prefix+key)
+				continue
+			}
+			unknown = append(unknown, unknownConfKeys(v[key], field.Type, prefix+key+".")...)
+		}
+	case []interface{}:
+		if reflect.Slice != t.Kind() {
 			return nil
-		} else {
-			return gs
+		}
+		for i, item := range v {
+			unknown = append(unknown, unknownConfKeys(item, t.Elem(), fmt.Sprintf("%s%d.", prefix, i))...)
 		}
 	}
+	return unknown
+}
+
+/**
+* Config parse error with the file, line, column and key
+ */
+func confError(file string, data []byte, err error) error {
+	position := func(offset int64) string {
+		if offset > int64(len(data)) {
+			offset = int64(len(data))
+		}
+		before := data[:offset]
+		line := bytes.Count(before, []byte("\n")) + 1
+		return fmt.Sprintf("%s:%d:%d", file, line, len(before)-bytes.LastIndexByte(before, '\n'))
+	}
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return fmt.Errorf("%s: %s", position(e.Offset), e.Error())
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("%s: key %s: %s value, expected %s", position(e.Offset), e.Field, e.Value, e.Type)
+	}
+	return fmt.Errorf("%s: %s", file, err.Error())
 }
 
 func main() {
-	inputFile := flag.String("i", "", "Default read source schema info from database， use -i，read source schema info from file")
+	configFile := flag.String("config", "", "Config file, or the directory of app.conf, default <binary dir>/conf/app.conf. The conf.d/*.conf fragments beside it are merged in order")
+	inputFile := flag.String("i", "", "Default read source schema info from database， use -i，read source schema info from file, - for stdin")
+	inputDir := flag.String("d", "", "Read source schema from a directory of tables/*.sql, views/*.sql, routines/*.sql")
 	dropUnnecessary := flag.Bool("c", false, "Use the param execute delete unnecessary field / index ")
-	output := flag.String("o", "", "Save adjust SQL to file")
+	output := flag.String("o", "", "Save adjust SQL to file, - for stdout")
 	execute := flag.Bool("e", true, "Execute adjust SQL to dest database, default true")
+	split := flag.Bool("split", false, "export: write one file per table into the -o directory")
+	inputGo := flag.String("go", "", "Read source schema from the go structs with gorm / db tags in the package dir")
+	gitRef := flag.String("ref", "", "Read source schema from the git ref, -i / -d is the path in the repository")
+	gitRepo := flag.String("repo", "", "Git repository of -ref, default current directory")
+	dest := flag.String("dest", "", "diff: schema file or directory to compare with")
+	destRef := flag.String("dest-ref", "", "diff: git ref of the schema to compare with")
+	format := flag.String("format", "", "Format of the adjust SQL: sql (default), migrate (golang-migrate), flyway, liquibase or liquibase-yaml, the migration formats write to the -o dir")
+	tableDiff := flag.Bool("table-diff", false, "Print the unified diff of the create table of each changed table")
+	color := flag.String("color", "", "Color of -table-diff: auto (default), always or never")
+	junit := flag.String("junit", "", "Write the JUnit XML report of the run to the file, a testsuite per dest db and a testcase per table")
+	to := flag.String("to", "", "diff: dsn of the live database to compare with, ex: root:123456@tcp(127.0.0.1:3306)/sbsp")
+	pkg := flag.String("package", "", "codegen: package name, default the -o dir name")
+	tags := flag.String("tags", "", "codegen: tag styles, ex: db,json,gorm, default db,json")
+	bundle := flag.String("bundle", "", "apply: the bundle file created by the bundle command, - for stdin")
+	diagramFormat := flag.String("diagram-format", "", "diagram: dot or mermaid, default by the -o extension (.mmd / .md mermaid, else dot)")
+	diagramTable := flag.String("table", "", "diagram: only the tables within -depth foreign keys of the table")
+	diagramDepth := flag.Int("depth", 1, "diagram: foreign key depth around -table, -1 all the connected tables")
+	diagramPattern := flag.String("pattern", "", "diagram: only the tables matching the comma separated patterns, ex: user_*,order_*")
+	flag.Usage = usage
 
-	flag.Parse()
+	// Command is the first param, default sync
+	command := "sync"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	// Source schema from stdin, ex: mysqldump ... | StructSync diff - -to dsn
+	stdinSource := len(args) > 0 && "-" == args[0]
+	if stdinSource {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if stdinSource {
+		*inputFile = "-"
+	}
+	if !inStringSlice(command, Commands) {
+		fmt.Printf("Unknown command [%s]\r\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	// Set CPU Numbers
 	runtime.GOMAXPROCS(runtime.NumCPU())
@@ -49,13 +216,25 @@ func main() {
 	nowTime := fmt.Sprintf("%02d%02d%02d", now.Hour(), now.Minute(), now.Second())
 
 	// Read config file
-	confFile := common.GetConfigFile(os.Args[0], ConfName)
+	confFile := *configFile
+	if "" == confFile {
+		confFile = common.GetConfigFile(os.Args[0], ConfName)
+	} else if info, err := os.Stat(confFile); nil == err && info.IsDir() {
+		confFile = filepath.Join(confFile, ConfName)
+	}
 	exists, err := common.PathExists(confFile)
 	if err != nil || !exists {
 		fmt.Printf("The config file [%s] not exists!\r\n", confFile)
 		os.Exit(1)
 	}
-	globalSetting := ReadConf(confFile)
+	globalSetting, err := ReadConf(confFile)
+	if nil == err {
+		err = service.ResolveSecrets(globalSetting, filepath.Dir(confFile))
+	}
+	if nil != err {
+		fmt.Println("Read config failed!", err)
+		os.Exit(1)
+	}
 
 	if "" == globalSetting.LogFileName {
 		globalSetting.LogFileName = "StructSync_${date}.log"
@@ -73,44 +252,189 @@ func main() {
 
 	globalSetting.InputSql = *inputFile // Input path (must absolute path)
 
-	if len(*output) > 0 {
+	if len(*output) > 0 && command == "sync" {
 		globalSetting.OutputDir = *output // Output path
+		if "-" == *output {
+			globalSetting.SaveSQL = true
+		}
+	}
+	if command != "sync" { // only sync save and execute the adjust sql, apply executes the bundle
+		globalSetting.SaveSQL = false
+		globalSetting.ExecuteSQL = globalSetting.ExecuteSQL && command == "apply"
 	}
-	if len(*inputFile) > 0 {
+	if len(*gitRepo) > 0 {
+		globalSetting.GitRepo = *gitRepo
+	}
+	if len(*gitRef) > 0 {
+		globalSetting.InputMode = service.GitMode
+		globalSetting.GitRef = *gitRef
+		if len(*inputDir) > 0 {
+			globalSetting.GitPath = *inputDir
+		} else if len(*inputFile) > 0 {
+			globalSetting.GitPath = *inputFile
+		}
+	} else if globalSetting.InputMode == service.GitMode && "" != globalSetting.GitRef {
+		// git source of the config file
+	} else if len(*inputGo) > 0 {
+		globalSetting.InputMode = service.GoMode
+		globalSetting.InputGoDir = *inputGo
+	} else if len(*inputDir) > 0 {
+		globalSetting.InputMode = service.DirMode
+		globalSetting.InputDir = *inputDir
+	} else if len(*inputFile) > 0 {
 		globalSetting.InputMode = service.FileMode
 	} else {
 		globalSetting.InputMode = service.DbMode
 	}
 
+	if len(*format) > 0 {
+		globalSetting.OutputFormat = *format
+	}
+	if "" != globalSetting.OutputFormat && !inStringSlice(globalSetting.OutputFormat, service.OutputFormats) {
+		fmt.Printf("Unknown output format [%s]\r\n", globalSetting.OutputFormat)
+		os.Exit(2)
+	}
+	if *tableDiff {
+		globalSetting.TableDiff = true
+	}
+	if len(*color) > 0 {
+		globalSetting.DiffColor = *color
+	}
+	if len(*junit) > 0 {
+		globalSetting.JUnitReport = *junit
+	}
+	if "" != globalSetting.DiffColor && !inStringSlice(globalSetting.DiffColor, service.DiffColors) {
+		fmt.Printf("Unknown diff color [%s]\r\n", globalSetting.DiffColor)
+		os.Exit(2)
+	}
+	if "" != globalSetting.OutputMode && !inStringSlice(globalSetting.OutputMode, service.OutputModes) {
+		fmt.Printf("Unknown output mode [%s]\r\n", globalSetting.OutputMode)
+		os.Exit(2)
+	}
+	if "" != globalSetting.StmtTimeOut {
+		if timeout, err := time.ParseDuration(globalSetting.StmtTimeOut); nil != err || timeout <= 0 {
+			fmt.Printf("Invalid StmtTimeOut [%s], use a duration like 300s or 5m\r\n", globalSetting.StmtTimeOut)
+			os.Exit(2)
+		}
+	}
+	if "-" == *output && "" != globalSetting.OutputFormat && service.OutputFormatSQL != globalSetting.OutputFormat {
+		fmt.Println("Migrations can't be written to stdout, use -o <dir>")
+		os.Exit(2)
+	}
+
+	if len(*pkg) > 0 {
+		globalSetting.CodegenPackage = *pkg
+	}
+	if len(*tags) > 0 {
+		globalSetting.CodegenTags = *tags
+	} else if "" == globalSetting.CodegenTags {
+		globalSetting.CodegenTags = "db,json"
+	}
+
 	if globalSetting.TimeOut == "" {
 		globalSetting.TimeOut = "600s"
 	}
 
 	service.InitGlobalSet(globalSetting)
 
-	if globalSetting.InputMode != service.DbMode { // from file
+	// Stdout is for the streamed sql, the messages go to stderr
+	if "-" == *output || (("diff" == command || "diagram" == command) && "" == *output) {
+		os.Stdout = os.Stderr
+	}
+
+	if "apply" == command { // the changes come from the bundle
+	} else if globalSetting.InputMode == service.GitMode { // from git ref
+		fmt.Println("Sync Mode: Use git", globalSetting.GitRef, "sync struct")
+	} else if globalSetting.InputMode == service.GoMode { // from go struct
+		fmt.Println("Sync Mode: Use go struct sync struct")
+	} else if globalSetting.InputMode == service.DirMode { // from directory
+		fmt.Println("Sync Mode: Use directory sync struct")
+	} else if globalSetting.InputMode != service.DbMode { // from file
 		fmt.Println("Sync Mode: Use file sync struct")
 	} else {
 		fmt.Println("Sync Mode: Use database sync struct")
 	}
 
 	t := service.NewMyTimer()
-	fmt.Println("Database struct sync begin!")
+	fmt.Println("Database struct", command, "begin!")
 
 	defer (func() {
 		if err := recover(); err != nil {
 			t.Stop()
 			fmt.Println("Database struct sync interrupt!", err)
 			debug.PrintStack()
+			os.Exit(1)
 		}
 	})()
 
-	// Start sync struct
-	service.StartDatabaseSync()
+	// Cancel the running statements when interrupted
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Println("Database struct sync canceling...")
+		service.CancelSync()
+	}()
+
+	// 0 succeed, 1 failed, 2 changes left
+	exitCode := 0
+	switch command {
+	case "export":
+		if err := service.ExportSchema(*output, *split); nil != err {
+			t.Stop()
+			fmt.Println("Database struct export failed!", err)
+			os.Exit(1)
+		}
+	case "diff":
+		rets, err := service.DiffSchema(*dest, *destRef, *to, *output)
+		if nil != err {
+			t.Stop()
+			fmt.Println("Database struct diff failed!", err)
+			os.Exit(1)
+		}
+		exitCode = service.SyncExitCode(rets)
+	case "codegen":
+		err := service.GenerateModels(*output, globalSetting.CodegenPackage, strings.Split(globalSetting.CodegenTags, ","))
+		if nil != err {
+			t.Stop()
+			fmt.Println("Database struct codegen failed!", err)
+			os.Exit(1)
+		}
+	case "docs":
+		if err := service.GenerateDocs(*output); nil != err {
+			t.Stop()
+			fmt.Println("Database struct docs failed!", err)
+			os.Exit(1)
+		}
+	case "bundle":
+		if err := service.CreateBundle(*dest, *destRef, *to, *output); nil != err {
+			t.Stop()
+			fmt.Println("Database struct bundle failed!", err)
+			os.Exit(1)
+		}
+	case "apply":
+		rets, err := service.ApplyBundle(*bundle, *to)
+		if nil != err {
+			t.Stop()
+			fmt.Println("Database struct apply failed!", err)
+			os.Exit(1)
+		}
+		exitCode = service.SyncExitCode(rets)
+	case "diagram":
+		if err := service.GenerateDiagram(*output, *diagramFormat, *diagramTable, *diagramDepth, *diagramPattern); nil != err {
+			t.Stop()
+			fmt.Println("Database struct diagram failed!", err)
+			os.Exit(1)
+		}
+	default:
+		// Start sync struct
+		exitCode = service.SyncExitCode(service.StartDatabaseSync())
+	}
 
 
 	t.Stop()
 
 	// Complete
-	fmt.Println("Database struct sync finished! Time elapsed:", t.UsedSecond())
+	fmt.Println("Database struct", command, "finished! Time elapsed:", t.UsedSecond())
+	os.Exit(exitCode)
 }
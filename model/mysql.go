@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
@@ -8,10 +9,56 @@ import (
 	"strings"
 )
 
+// Statement canceled by timeout
+type TimeoutError struct {
+	SQL    string
+	Reason error
+}
+
+func (te *TimeoutError) Error() string {
+	return fmt.Sprintf("execute sql timeout (%s): %s", te.Reason.Error(), te.SQL)
+}
+
+// Statement canceled by the interrupt of the run
+type CanceledError struct {
+	SQL string
+}
+
+func (ce *CanceledError) Error() string {
+	return fmt.Sprintf("execute sql canceled: %s", ce.SQL)
+}
+
+/**
+* Check the error is a statement timeout
+ */
+func IsTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
+/**
+* Check the error is a statement canceled
+ */
+func IsCanceled(err error) bool {
+	_, ok := err.(*CanceledError)
+	return ok
+}
+
+/**
+* Error of the statement stopped by the context done
+ */
+func contextError(ctx context.Context, strSql string) error {
+	if context.Canceled == ctx.Err() {
+		return &CanceledError{SQL: strSql}
+	}
+	return &TimeoutError{SQL: strSql, Reason: ctx.Err()}
+}
+
 type FieldSchema struct {
 	FieldName    string
 	FieldType    string
 	FieldLen     int
+	ColumnType   string // full type, ex: int(10) unsigned
 	AllowNull    bool
 	DefaultValue string
 }
@@ -51,6 +98,13 @@ func (this *MysqlDb) Close() {
 * Query data from mysql
  */
 func (this *MysqlDb) Query(sql string) (*sql.Rows, error) {
+	return this.QueryContext(context.Background(), sql)
+}
+
+/**
+* Query data from mysql, canceled with the context
+ */
+func (this *MysqlDb) QueryContext(ctx context.Context, sql string) (*sql.Rows, error) {
 	if nil == this.Db {
 		return nil, fmt.Errorf("invalid database connection")
 	}
@@ -59,7 +113,7 @@ func (this *MysqlDb) Query(sql string) (*sql.Rows, error) {
 		return nil, fmt.Errorf("inavlid SQL")
 	}
 
-	rows, err := this.Db.Query(sql)
+	rows, err := this.Db.QueryContext(ctx, sql)
 	if nil != err {
 		return nil, err
 	}
@@ -85,10 +139,10 @@ func (this *MysqlDb) QueryRow(sql string) (*sql.Row, error) {
 }
 
 /**
-* Query all tables from the databases
+* Query all tables from the databases, views are not included
  */
 func (this *MysqlDb) GetTableNames() []string {
-	rows, err := this.Query("show tables")
+	rows, err := this.Query("show full tables where Table_type = 'BASE TABLE'")
 	if nil != err {
 		return nil
 	}
@@ -96,8 +150,8 @@ func (this *MysqlDb) GetTableNames() []string {
 	defer rows.Close()
 	var table_list []string
 	for rows.Next() {
-		var table_name string
-		err = rows.Scan(&table_name)
+		var table_name, table_type string
+		err = rows.Scan(&table_name, &table_type)
 		if nil != err {
 			return nil
 		}
@@ -130,10 +184,71 @@ func (this *MysqlDb) GetTableSchema(tableName string) (string, error) {
 	return schema, nil
 }
 
+/**
+* Query names of views, procedures, functions or triggers
+* objType: VIEW, PROCEDURE, FUNCTION, TRIGGER
+ */
+func (this *MysqlDb) GetObjectNames(objType string) ([]string, error) {
+	var sql string
+	switch objType {
+	case "VIEW":
+		sql = "SELECT TABLE_NAME AS name FROM information_schema.VIEWS WHERE TABLE_SCHEMA = DATABASE()"
+	case "PROCEDURE", "FUNCTION":
+		sql = "SELECT ROUTINE_NAME AS name FROM information_schema.ROUTINES" +
+			" WHERE ROUTINE_SCHEMA = DATABASE() AND ROUTINE_TYPE = '" + objType + "'"
+	case "TRIGGER":
+		sql = "SELECT TRIGGER_NAME AS name FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = DATABASE()"
+	default:
+		return nil, fmt.Errorf("unsupport object type: %s", objType)
+	}
+
+	_, rows, err := this.SqlQuery(sql)
+	if nil != err {
+		return nil, err
+	}
+
+	var names []string
+	for _, row := range rows {
+		names = append(names, row["name"])
+	}
+	return names, nil
+}
+
+/**
+* Query the create sql of view, procedure, function or trigger
+ */
+func (this *MysqlDb) GetObjectSchema(objType, name string) (string, error) {
+	column := map[string]string{
+		"VIEW":      "Create View",
+		"PROCEDURE": "Create Procedure",
+		"FUNCTION":  "Create Function",
+		"TRIGGER":   "SQL Original Statement",
+	}[objType]
+	if "" == column {
+		return "", fmt.Errorf("unsupport object type: %s", objType)
+	}
+
+	_, rows, err := this.SqlQuery(fmt.Sprintf("show create %s `%s`", strings.ToLower(objType), name))
+	if nil != err {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return rows[0][column], nil
+}
+
 /*
-*  Parser the fieldtype info, split field type and length
+*  Split field type and length, see SplitFieldType
  */
 func (this *MysqlDb) SplitFileType(fieldType string) (string, int, error) {
+	return SplitFieldType(fieldType)
+}
+
+/*
+*  Parser the fieldtype info, split field type and length
+ */
+func SplitFieldType(fieldType string) (string, int, error) {
 	if strings.Contains(fieldType, "(") {
 		var s = strings.Split(fieldType, "(")
 		var sType = s[0]
@@ -169,6 +284,7 @@ func (this *MysqlDb) GetColumnsSchema(tableName string) (*map[string]*FieldSchem
 			schema.FieldName = row["Field"]
 			schema.FieldLen = f_len
 			schema.FieldType = f_type
+			schema.ColumnType = row["Type"]
 			schema.DefaultValue = strings.Trim(row["Default"], "'")
 
 			schemas[schema.FieldName] = schema
@@ -183,8 +299,15 @@ func (this *MysqlDb) GetColumnsSchema(tableName string) (*map[string]*FieldSchem
  * Execute the query
  */
 func (this *MysqlDb) SqlQuery(strSql string) (int, []map[string]string, error) {
+	return this.SqlQueryContext(context.Background(), strSql)
+}
+
+/*
+ * Execute the query, canceled with the context
+ */
+func (this *MysqlDb) SqlQueryContext(ctx context.Context, strSql string) (int, []map[string]string, error) {
 	//Execute sql
-	rows, err := this.Db.Query(strSql)
+	rows, err := this.Db.QueryContext(ctx, strSql)
 	if err != nil {
 		return -1, nil, err
 	}
@@ -233,11 +356,58 @@ func (this *MysqlDb) GetCount(strSql, countField string) int {
  * Execute the query
  */
 func (this *MysqlDb) SqlExec(strSql string) (int, error) {
-	result, err := this.Db.Exec(strSql)
+	return this.ExecContext(context.Background(), strSql)
+}
+
+/*
+ * Execute the query, canceled with the context
+ */
+func (this *MysqlDb) ExecContext(ctx context.Context, strSql string) (int, error) {
+	result, err := this.Db.ExecContext(ctx, strSql)
+	if err != nil {
+		if nil != ctx.Err() {
+			return -1, contextError(ctx, strSql)
+		}
+		return -1, err
+	}
+
+	rowsAffectNum, err := result.RowsAffected()
 	if err != nil {
 		return -1, err
 	}
 
+	return int(rowsAffectNum), nil
+}
+
+/*
+ * Execute the query on a dedicated connection, when the context is done
+ * kill the statement on the server, the client side cancel not stop a running ALTER
+ */
+func (this *MysqlDb) ExecKillOnTimeout(ctx context.Context, strSql string) (int, error) {
+	conn, err := this.Db.Conn(context.Background())
+	if nil != err {
+		return -1, err
+	}
+	defer conn.Close()
+
+	var connId int64
+	if err = conn.QueryRowContext(context.Background(), "SELECT CONNECTION_ID()").Scan(&connId); nil != err {
+		return -1, err
+	}
+
+	result, err := conn.ExecContext(ctx, strSql)
+	if nil != err {
+		if nil == ctx.Err() {
+			return -1, err
+		}
+
+		ctxErr := contextError(ctx, strSql)
+		if _, killErr := this.Db.Exec(fmt.Sprintf("KILL QUERY %d", connId)); nil != killErr {
+			return -1, fmt.Errorf("%s, kill query %d failed: %s", ctxErr.Error(), connId, killErr.Error())
+		}
+		return -1, ctxErr
+	}
+
 	rowsAffectNum, err := result.RowsAffected()
 	if err != nil {
 		return -1, err
@@ -1,14 +1,19 @@
 package service
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"io"
-	"os"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"struct_sync/logger"
 	db "struct_sync/model"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type InputMode int64
@@ -16,16 +21,22 @@ type InputMode int64
 const (
 	DbMode   InputMode = 0x1
 	FileMode InputMode = 0x2
+	DirMode  InputMode = 0x3
+	GitMode  InputMode = 0x4
+	GoMode   InputMode = 0x5
 )
 
 // Source db struct map
 var gTableList map[string]*MySchema
 
+// Source views, routines and triggers
+var gObjectList []*DbObject
+
 // global config object
 var globalSet *GlobalSet
 
-// diff sql list
-var gSqlList []string
+// run context, canceled by CancelSync
+var gCtx, gCancel = context.WithCancel(context.Background())
 
 // global config
 type GlobalSet struct {
@@ -43,6 +54,53 @@ type GlobalSet struct {
 	LogLevel       int       // Log level
 	LogPath        string    // default ${app}/log
 	LogFileName    string    // log file name, ex: StructSync_20190101.log  or StructSync_${date}${time}.log
+
+	InputDbName    string        // database to use when the schema file (mysqldump output) has more than one
+	InputDir       string        // source schema directory
+	SchemaLayout   *SchemaLayout // sub directory of each object type in InputDir
+	SchemaFileGlob string        // schema file pattern in InputDir, default *.sql
+	SyncObjects    bool          // sync views, procedures, functions and triggers
+
+	InputGoDir   string // go package dir of GoMode, the structs with gorm / db tags are tables
+	GoStringSize int    // varchar size of the go string fields without size tag, 0 as gorm: longtext, varchar(191) for keys
+
+	CodegenPackage string // package name of the generated models, default the output dir name
+	CodegenTags    string // tag styles of the generated models, ex: db,json,gorm, default db,json
+
+	DocsDir string // regenerate the data dictionary of the source schema to the dir on each sync
+
+	GitRepo string // schema git repository, default current directory
+	GitRef  string // source ref of GitMode, ex: HEAD, v1.4.0
+	GitPath string // schema file or directory in the repository, default the repository root
+
+	PreCheck         bool   // run pre-flight safety checks on dest db before execute sql
+	PreCheckRetry    int    // re-check times when pre-flight check failed, then skip the dest db
+	PreCheckInterval string // wait time between pre-flight checks, default 30s
+	MaxTrxTime       int    // max seconds a transaction may be open on dest db, default 60
+	MaxReplicaLag    int    // max replica lag seconds of dest db, 0 not check
+
+	ShadowDryRun bool   // apply adjust sql on a temporary shadow database before the dest db
+	ShadowDbDsn  *DBSet // scratch server for the shadow database, default the dest db server
+
+	ForeignKeyChecksOff bool // run adjust sql with SET FOREIGN_KEY_CHECKS=0
+
+	StmtTimeOut     string // max duration of one statement, ex: 300s, default no limit
+	LockWaitTimeout int    // session lock_wait_timeout seconds of dest db, 0 use server setting
+	KillOnTimeout   bool   // KILL the running statement on server when it timeout
+
+	OutputFormat    string // format of the saved sql: sql (default), migrate, flyway, liquibase or liquibase-yaml
+	MigrationDir    string // migrations directory of the migrate, flyway and liquibase formats, default OutputDir
+	ChangelogAuthor string // author of the liquibase changeSets, default StructSync
+
+	OutputMode     string // overwrite (default), append or versioned (<OutputDir>/<date>/<time> per run)
+	OutputPerTable bool   // one annotated file per table in <OutputDir>/<db>@<host>#<port>/
+
+	TableDiff bool   // print the unified diff of the create table of each changed table
+	DiffColor string // color of the table diff: auto (default), always or never
+
+	JUnitReport string // write the JUnit XML report of the run to the file, a testsuite per dest db and a testcase per table
+
+	CredentialCmd string // command printing the password of the db sets with empty Pswd, gets STRUCTSYNC_HOST/PORT/USER/DB
 }
 
 // db connection info
@@ -57,45 +115,292 @@ type DBSet struct {
 }
 
 // Sync result
+const (
+	syncRetFailed  = 0
+	syncRetSucceed = 1
+	syncRetPart    = 2
+	syncRetSkipped = 3
+	syncRetDrift   = 4
+	syncRetTimeout = 5
+)
+
 type SyncRet struct {
-	Id  string
-	Ret int    // Execute result: 0 all failed 1 all success, 2 part success
+	Id      string
+	DbName  string      // dest db, ex: test_1@127.0.0.1#3306
+	Ret     int         // Execute result: 0 all failed 1 all success, 2 part success, 3 skipped, 4 applied but still drifting
+	Msg     string      // skip or fail reason
+	Drift   []string    // differences left after execute
+	Timeout int         // number of statements timeout
+	Changes int         // number of table and object changes found
+	Tables  []*TableRet // result of each table and object, for the report
+}
+
+// result of one table or object of the dest db
+type TableRet struct {
+	Name    string    // table name, or the object, ex: VIEW `v_user`
+	Type    AlterType // alterTypeNo when same as the source
+	SQL     string    // adjust sql
+	Diff    string    // unified diff of the create table
+	Applied bool      // adjust sql executed
+	Err     string    // execute error
+	Drift   string    // difference left after execute
+}
+
+func (sr SyncRet) String() string {
+	var status string
+	switch sr.Ret {
+	case syncRetFailed:
+		status = "failed"
+	case syncRetSucceed:
+		status = "succeed"
+	case syncRetPart:
+		status = "part succeed"
+	case syncRetSkipped:
+		status = "skipped"
+	case syncRetDrift:
+		status = "applied but still drifting"
+	case syncRetTimeout:
+		status = "timeout"
+	default:
+		status = "unknow"
+	}
+
+	if "" != sr.Msg {
+		status += ", " + sr.Msg
+	} else if sr.Changes > 0 && !globalSet.ExecuteSQL {
+		status += fmt.Sprintf(", %d change(s) not executed", sr.Changes)
+	}
+	return fmt.Sprintf("%s : %s", sr.DbName, status)
 }
 
 /**
-* Init Global config
+* Result of each source table (same when not in the plan), each table to drop and each object change.
+* A table of a foreign key cycle has two statements in the plan, the create and its foreign keys, or the drop of its foreign keys and the drop
  */
-func InitGlobalSet(set *GlobalSet) {
-	globalSet = set
-	if globalSet.SaveSQL {
-		globalSet.OutputDir += "/" + time.Now().Format("2006-01-02")
-		_, err := os.Stat(globalSet.OutputDir)
-		if nil != err {
-			err = os.MkdirAll(globalSet.OutputDir, os.ModeDir|os.ModePerm)
-			if nil != err {
-				logger.Fatal("Create dir failed, dir =", globalSet.OutputDir, ",", err.Error())
+func newTableRets(destName string, plan []*TableAlterData, objAlters []*ObjectAlterData) []*TableRet {
+	names := sortedTableNames(gTableList)
+	alters := make(map[string][]*TableAlterData)
+	for _, sd := range plan {
+		if nil == gTableList[sd.Table] && nil == alters[sd.Table] {
+			names = append(names, sd.Table)
+		}
+		alters[sd.Table] = append(alters[sd.Table], sd)
+	}
+
+	var rets []*TableRet
+	for _, name := range names {
+		tr := &TableRet{Name: name, Type: alterTypeNo}
+		if sds := alters[name]; len(sds) > 0 {
+			var types []AlterType
+			var sqls []string
+			for _, sd := range sds {
+				types = append(types, sd.Type)
+				sqls = append(sqls, strings.TrimRight(strings.TrimSpace(sd.SQL), ";"))
 			}
+			tr.Type = tableAlterType(types)
+			tr.SQL = strings.Join(sqls, ";\n") + ";\n"
+			tr.Diff = sds[0].textDiff(destName) // the first change has the whole definitions, see printTableDiffs
 		}
+		rets = append(rets, tr)
+	}
+
+	for _, oa := range objAlters {
+		rets = append(rets, &TableRet{Name: oa.Object.String(), Type: oa.Type, SQL: oa.fileSQL()})
 	}
+	return rets
 }
 
 /**
-* Init Src database
+* Change of the table by the types of its statements, the create or the drop, else alter
  */
-func InitSrcDbSchema(dbSet *DBSet) {
-	if dbSet.timeout == "" {
-		dbSet.timeout = globalSet.TimeOut
+func tableAlterType(types []AlterType) AlterType {
+	for _, t := range types {
+		if alterTypeCreate == t || alterTypeDrop == t {
+			return t
+		}
 	}
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&timeout=%s",
+	return types[0]
+}
+
+func (sr *SyncRet) tableRetMap() map[string]*TableRet {
+	rets := make(map[string]*TableRet, len(sr.Tables))
+	for _, tr := range sr.Tables {
+		rets[tr.Name] = tr
+	}
+	return rets
+}
+
+/**
+* Result by the executed statements, the canceled ones were stopped by the interrupt of the run
+ */
+func (sr *SyncRet) setExecuted(numOk, numFailed, numTimeout, numCanceled int) {
+	if numOk == 0 && numFailed+numCanceled > 0 {
+		sr.Ret = syncRetFailed
+	} else if numFailed+numCanceled > 0 {
+		sr.Ret = syncRetPart
+	}
+	if numTimeout > 0 {
+		sr.Ret = syncRetTimeout
+		sr.Timeout = numTimeout
+	}
+	if numTimeout > 0 || numCanceled > 0 {
+		var counts []string
+		if numTimeout > 0 {
+			counts = append(counts, fmt.Sprintf("%d statement(s) timeout", numTimeout))
+		}
+		if numCanceled > 0 {
+			counts = append(counts, fmt.Sprintf("%d statement(s) canceled", numCanceled))
+		}
+		sr.Msg = fmt.Sprintf("%s, %d failed, %d succeed", strings.Join(counts, ", "), numFailed, numOk)
+	}
+	logger.Info("All sql execute done, succeed", numOk, ", failed:", numFailed, ", timeout:", numTimeout, ", canceled:", numCanceled)
+}
+
+/**
+* Differences left after execute, ex: `table` ALTER ..., added to the message of the executed statements
+ */
+func (sr *SyncRet) setDrift(drift []string) {
+	sr.Drift = drift
+	if len(drift) == 0 {
+		return
+	}
+
+	tableRets := sr.tableRetMap()
+	for _, d := range drift {
+		if parts := strings.SplitN(d, "`", 3); len(parts) == 3 && nil != tableRets[parts[1]] {
+			tableRets[parts[1]].Drift = d
+		}
+	}
+	if sr.Ret == syncRetSucceed {
+		sr.Ret = syncRetDrift
+	}
+	msg := fmt.Sprintf("%d table(s) still drifting: %s", len(drift), strings.Join(drift, "; "))
+	if "" != sr.Msg {
+		msg = sr.Msg + "; " + msg
+	}
+	sr.Msg = msg
+}
+
+/**
+* Exit code of the run: 0 all succeed and nothing left to change,
+* 1 any failed, skipped or timeout, 2 changes not executed or still drifting
+ */
+func SyncExitCode(rets []SyncRet) int {
+	code := 0
+	for _, ret := range rets {
+		switch ret.Ret {
+		case syncRetSucceed:
+			if ret.Changes > 0 && !globalSet.ExecuteSQL {
+				code = 2
+			}
+		case syncRetDrift:
+			code = 2
+		default:
+			return 1
+		}
+	}
+	return code
+}
+
+/**
+* Print the result of each dest
+ */
+func printSyncSummary(rets []SyncRet) {
+	sort.Slice(rets, func(i, j int) bool { return rets[i].DbName < rets[j].DbName })
+	fmt.Println("Sync Summary:")
+	for _, ret := range rets {
+		fmt.Println("  " + logger.Redact(ret.String()))
+	}
+}
+
+/**
+* Connection string of the db server, use dbName as default database
+ */
+func (dbSet *DBSet) dsn(dbName string) string {
+	// root:123456@tcp(127.0.0.1:3306)/sbsp?charset=utf8
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&timeout=%s",
 		dbSet.User,
 		dbSet.Pswd,
 		dbSet.Host,
 		dbSet.Port,
-		dbSet.DbName,
+		dbName,
 		dbSet.Charset,
 		dbSet.timeout)
+}
+
+/**
+* Db set of a go mysql dsn, ex: root:123456@tcp(127.0.0.1:3306)/sbsp?charset=utf8
+ */
+func dbSetFromDSN(dsn string) (*DBSet, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if nil != err {
+		return nil, err
+	}
+	if "" == cfg.DBName {
+		return nil, fmt.Errorf("database name not set in dsn")
+	}
+	host, port, err := net.SplitHostPort(cfg.Addr)
+	if nil != err {
+		return nil, fmt.Errorf("tcp address only: %s", err.Error())
+	}
+
+	// charset is not exported by the driver config
+	charset := "utf8mb4"
+	if p := strings.Index(dsn, "?"); p >= 0 {
+		if params, err := url.ParseQuery(dsn[p+1:]); nil == err && "" != params.Get("charset") {
+			charset = params.Get("charset")
+		}
+	}
+
+	logger.AddSecret(cfg.Passwd)
+	return &DBSet{Host: host, Port: port, DbName: cfg.DBName, User: cfg.User, Pswd: cfg.Passwd, Charset: charset}, nil
+}
+
+/**
+* Dest db name for log and output file
+ */
+func (dbSet *DBSet) String() string {
+	return fmt.Sprintf("%s@%s#%s", dbSet.DbName, dbSet.Host, dbSet.Port)
+}
+
+/**
+* Cancel the running sync, the executing statements are canceled
+ */
+func CancelSync() {
+	gCancel()
+}
+
+/**
+* Init Global config
+ */
+func InitGlobalSet(set *GlobalSet) {
+	globalSet = set
+	if "" == globalSet.OutputFormat {
+		globalSet.OutputFormat = OutputFormatSQL
+	}
+	if isMigrationFormat(globalSet.OutputFormat) && "" == globalSet.MigrationDir {
+		globalSet.MigrationDir = globalSet.OutputDir
+	}
+	if "" == globalSet.OutputMode {
+		globalSet.OutputMode = OutputModeOverwrite
+	}
+	if globalSet.SaveSQL && stdioPath != globalSet.OutputDir && OutputFormatSQL == globalSet.OutputFormat {
+		dir, err := outputRunDir(globalSet.OutputDir, globalSet.OutputMode, time.Now())
+		if nil != err {
+			logger.Fatal("Create dir failed, dir =", dir, ",", err.Error())
+		}
+		globalSet.OutputDir = dir
+	}
+}
 
-	srcDb, err := db.NewMysqlDb(dsn)
+/**
+* Init Src database
+ */
+func InitSrcDbSchema(dbSet *DBSet) {
+	if dbSet.timeout == "" {
+		dbSet.timeout = globalSet.TimeOut
+	}
+	srcDb, err := db.NewMysqlDb(dbSet.dsn(dbSet.DbName))
 	if nil != err {
 		logger.Fatal("Init Source Database Failed!", err.Error())
 		panic("Init Source Database Failed: " + err.Error())
@@ -126,16 +431,61 @@ func InitSrcDbSchema(dbSet *DBSet) {
 		tblSchema.FieldSchemas = *fldSchema
 		gTableList[tableName] = tblSchema
 	}
+
+	if globalSet.SyncObjects {
+		gObjectList, err = getDbObjects(srcDb)
+		if nil != err {
+			logger.Fatal("Get Source Database Objects Failed", err.Error())
+			panic("Get Source Database Objects Failed: " + err.Error())
+		}
+	}
 }
 
 /**
-* begin check src & dest db difference
+* Use the parsed schema as source
  */
-func StartDatabaseSync() {
+func setSourceSchema(source *schemaSource) {
+	gTableList = source.Tables
+	gObjectList = source.Objects
+}
+
+/**
+* Load the source schema by input mode
+ */
+func loadSourceSchema() {
 	if globalSet.InputMode == DbMode {
 		InitSrcDbSchema(globalSet.SrcDbDsn)
 	} else if globalSet.InputMode == FileMode {
 		ParseSQLFile()
+	} else if globalSet.InputMode == DirMode {
+		loadSchemaDir()
+	} else if globalSet.InputMode == GitMode {
+		source, err := loadGitSchema(globalSet.GitRef)
+		if nil != err {
+			logger.Fatal("Load Git Schema Failed:", err.Error())
+			panic("Load Git Schema Failed: " + err.Error())
+		}
+		setSourceSchema(source)
+	} else if globalSet.InputMode == GoMode {
+		source, err := loadGoSchema(globalSet.InputGoDir)
+		if nil != err {
+			logger.Fatal("Load Go Struct Failed:", err.Error())
+			panic("Load Go Struct Failed: " + err.Error())
+		}
+		setSourceSchema(source)
+	}
+}
+
+/**
+* begin check src & dest db difference
+ */
+func StartDatabaseSync() []SyncRet {
+	loadSourceSchema()
+
+	if "" != globalSet.DocsDir {
+		if err := writeDocs(globalSet.DocsDir); nil != err {
+			logger.Warn("Generate docs failed: ", globalSet.DocsDir, ",", err.Error())
+		}
 	}
 
 	totalNum := len(globalSet.DestDbList)
@@ -152,131 +502,168 @@ func StartDatabaseSync() {
 			dbSet.timeout = "600s"
 		}
 
-		if globalSet.InputMode == DbMode {
-			go DiffOneDB(syncChan, dbSet, string(index))
-		} else {
-			go FillOneDB(syncChan, dbSet, string(index))
-		}
+		go DiffOneDB(syncChan, dbSet, strconv.Itoa(index))
 	}
 
 	// Wait for execute result
+	rets := make([]SyncRet, 0, totalNum)
 	for j := 0; j < totalNum; j++ {
 		ret := <-syncChan
 		logger.Info(ret)
+		rets = append(rets, ret)
 	}
+
+	// Run summary
+	printSyncSummary(rets)
+	writeJUnitReport(rets)
+	return rets
 }
 
 /**
 * Diff One database
  */
 func DiffOneDB(syncChan chan SyncRet, dbSet *DBSet, id string) {
-	syncRet := SyncRet{Id: id, Ret: 0}
+	syncRet := SyncRet{Id: id, DbName: dbSet.String(), Ret: syncRetFailed}
 	schemaSync := NewSchemaSync(dbSet)
 	if nil == schemaSync {
 		fmt.Println(dbSet.Host, dbSet.DbName, "Database connection fail")
+		syncRet.Msg = "database connection fail"
 		syncChan <- syncRet
 		return
 	}
 	defer schemaSync.DestDb.Close()
 
 	fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Begin Sync...")
-	changedTables := make(map[string][]*TableAlterData)
-	for table, _ := range gTableList {
-		sd := schemaSync.getAlterDataByTable(table)
-		if sd.Type != alterTypeNo {
-			relationTables := sd.SchemaDiff.RelationTables()
-			groupKey := "multi"
-			if 0 == len(relationTables) {
-				groupKey = "single_" + table
-			}
-
-			if _, has := changedTables[groupKey]; !has {
-				changedTables[groupKey] = make([]*TableAlterData, 0)
-			}
-
-			changedTables[groupKey] = append(changedTables[groupKey], sd)
-		} else {
-			var s = fmt.Sprintf("%s@%s TABLE %s Same", dbSet.DbName, dbSet.Host, table)
-			logger.Info(s)
+	plan, objAlters := schemaSync.alterPlan()
+	printTableDiffs(dbSet.String(), plan)
+	syncRet.Changes = len(plan) + len(objAlters)
+	syncRet.Tables = newTableRets(dbSet.String(), plan, objAlters)
+	tableRets := syncRet.tableRetMap()
+
+	// Pre-flight check before execute
+	if globalSet.ExecuteSQL && globalSet.PreCheck && len(plan) > 0 {
+		if err := schemaSync.preCheck(plan); nil != err {
+			fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Skip Sync,", err.Error())
+			syncRet.Ret = syncRetSkipped
+			syncRet.Msg = err.Error()
+			syncChan <- syncRet
+			return
 		}
 	}
 
-	//Check Unecessary
-	if globalSet.DropUnecessary {
-		destTableList := schemaSync.DestDb.GetTableNames()
-
-		for _, table := range destTableList {
-			if gTableList[table] == nil {
-				alter := &TableAlterData{Table: table, Type: alterTypeDrop}
-				dropSQL := fmt.Sprintf("DROP TABLE `%s`", table)
-				alter.SQL = dropSQL
-				groupKey := "single_" + table
-				changedTables[groupKey] = make([]*TableAlterData, 0)
-				changedTables[groupKey] = append(changedTables[table], alter)
-
-				schemaSync.addWarnLog("DiffOneDB",
-					fmt.Sprint("[TABLE.DROP] ", table, ", SQL=", dropSQL))
-			}
+	// Try the adjust sql on a shadow database first
+	if globalSet.ExecuteSQL && globalSet.ShadowDryRun && len(plan) > 0 {
+		if err := schemaSync.shadowDryRun(plan); nil != err {
+			fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Skip Sync,", err.Error())
+			syncRet.Ret = syncRetSkipped
+			syncRet.Msg = err.Error()
+			syncChan <- syncRet
+			return
 		}
 	}
 
 	numOk := 0
 	numFailed := 0
-	canRunTypePref := "single"
-	var hFile *os.File
-
-	if globalSet.SaveSQL {
+	numTimeout := 0
+	numCanceled := 0
+	var applied []*TableAlterData
+	var output *sqlOutput
+
+	if globalSet.SaveSQL && isMigrationFormat(globalSet.OutputFormat) {
+		dir := globalSet.MigrationDir
+		if len(globalSet.DestDbList) > 1 { // one migrations directory per dest db
+			dir = filepath.Join(dir, dbSet.String())
+		}
+		fileName, err := writeMigration(dir, dbSet.DbName, plan, objAlters)
+		if nil != err {
+			logger.Warn("Write migration failed: ", dir, ",", err.Error())
+		} else if "" != fileName {
+			fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Write migration", fileName)
+		}
+	} else if globalSet.SaveSQL {
 		var err error
-		fileName := globalSet.OutputDir + fmt.Sprintf("/%s@%s#%s.sql", dbSet.DbName, dbSet.Host, dbSet.Port)
-		hFile, err = os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.ModeAppend|os.ModePerm)
-		if nil != err { // File open fail
-			//bSave = false
-			logger.Warn("Create file failed: ", fileName, ",", err.Error())
+		if output, err = newSQLOutput(dbSet); nil != err { // File open fail
+			logger.Warn("Create output failed: ", dbSet, ",", err.Error())
 		}
+	}
 
-		defer hFile.Close()
+	if nil != output {
+		output.beginTables(plan)
 	}
 
-runSync:
-	for typeName, sds := range changedTables {
-		if !strings.HasPrefix(typeName, canRunTypePref) {
-			continue
+	for _, sd := range plan {
+		sql := strings.TrimRight(strings.TrimSpace(sd.SQL), ";") + ";\n"
+		if globalSet.ExecuteSQL { // Execute SQL
+			var ret error = schemaSync.SyncSQL2Dest(sql, nil)
+			if ret == nil {
+				numOk++
+				applied = append(applied, sd)
+				tableRets[sd.Table].Applied = true
+			} else if db.IsTimeout(ret) {
+				numTimeout++
+				tableRets[sd.Table].Err = "timeout: " + ret.Error()
+			} else if db.IsCanceled(ret) {
+				numCanceled++
+				tableRets[sd.Table].Err = ret.Error()
+			} else {
+				numFailed++
+				tableRets[sd.Table].Err = ret.Error()
+			}
 		}
 
-		var sqlList []string
-		for _, sd := range sds {
-			sql := strings.TrimRight(sd.SQL, ";")
-			sqlList = append(sqlList, sql)
+		if nil != output {
+			if err := output.writeTable(sd); nil != err {
+				logger.Warn("Write output failed: ", dbSet, ",", err.Error())
+			}
 		}
+	}
 
-		sql := strings.Join(sqlList, ";\n") + ";\n"
-		if globalSet.ExecuteSQL { // Execute SQL
-			var ret error = schemaSync.SyncSQL2Dest(sql, sqlList)
+	if nil != output {
+		output.endTables(plan)
+	}
+
+	// Views, routines and triggers after the tables
+	for _, oa := range objAlters {
+		if globalSet.ExecuteSQL {
+			var ret error
+			for _, sql := range oa.SQL {
+				if ret = schemaSync.SyncSQL2Dest(sql, nil); nil != ret {
+					break
+				}
+			}
+			tr := tableRets[oa.Object.String()]
 			if ret == nil {
 				numOk++
+				tr.Applied = true
+			} else if db.IsTimeout(ret) {
+				numTimeout++
+				tr.Err = "timeout: " + ret.Error()
+			} else if db.IsCanceled(ret) {
+				numCanceled++
+				tr.Err = ret.Error()
 			} else {
 				numFailed++
+				tr.Err = ret.Error()
 			}
 		}
 
-		if globalSet.SaveSQL {
-			hFile.WriteString(sql)
+		if nil != output {
+			if err := output.writeObject(oa); nil != err {
+				logger.Warn("Write output failed: ", dbSet, ",", err.Error())
+			}
 		}
 	}
 
-	if canRunTypePref == "single" {
-		canRunTypePref = "multi"
-		goto runSync
+	syncRet.Ret = syncRetSucceed
+	if globalSet.ExecuteSQL {
+		syncRet.setExecuted(numOk, numFailed, numTimeout, numCanceled)
+
+		// Verify the applied tables
+		syncRet.setDrift(schemaSync.verifyTables(applied))
 	}
 
-	syncRet.Ret = 1
-	if globalSet.ExecuteSQL {
-		if numOk == 0 {
-			syncRet.Ret = 0
-		} else if numFailed > 0 {
-			syncRet.Ret = 2
-		}
-		logger.Info("All sql execute done, succeed", numOk, ", failed:", numFailed)
+	if nil != output {
+		output.Close()
 	}
 
 	fmt.Println(dbSet.Host+"#"+dbSet.DbName, "End Sync！")
@@ -286,92 +673,19 @@ runSync:
 }
 
 /**
-* Parser SQL and execute
+* Parser the source schema file
  */
 func ParseSQLFile() {
-	hFile, err := os.Open(globalSet.InputSql)
+	source, err := parseSchemaFile(globalSet.InputSql)
 	if nil != err {
-		logger.Fatal("Parse SQL File Failed", err.Error())
+		logger.Fatal("Parse SQL File Failed:", err.Error())
 		panic("Parse SQL File Failed: " + err.Error())
 	}
 
-	defer hFile.Close()
-	var sqlList []string
-	var content string
-	buf := bufio.NewReader(hFile)
-	for {
-		line, err := buf.ReadString('\n')
-		if nil != err {
-			if err == io.EOF {
-				break
-			}
-
-			logger.Fatal("Parse SQL File Failed:", err.Error())
-			panic("Parse SQL File Failed: " + err.Error())
-		}
-
-		line = strings.TrimSpace(line)
-		if "" == line { // Empty Line
-			continue
-		}
-
-		if strings.HasPrefix(line, "-- ") { // Comment Line
-			continue
-		}
-
-		content += line
-		lastChar := line[len(line)-1:]
-		if lastChar == ";" {
-			sqlList = append(sqlList, content)
-			content = ""
-		}
-	}
-
-	if content != "" { // Maybe line miss ';'
-		sqlList = append(sqlList, content+";")
-	}
-
-	if nil == sqlList {
+	if 0 == len(source.Tables) {
 		logger.Fatal("SQL File Empty")
 		panic("SQL File Empty")
 	}
 
-	gSqlList = sqlList
-}
-
-/**
-* Fill database with file input
- */
-func FillOneDB(syncChan chan SyncRet, dbSet *DBSet, id string) {
-	syncRet := SyncRet{Id: id, Ret: 0}
-	schemaSync := NewSchemaSync(dbSet)
-	if nil == schemaSync { //  连接数据库失败
-		fmt.Println(dbSet.Host, dbSet.DbName, "Database connection fail")
-		syncChan <- syncRet
-		return
-	}
-	defer schemaSync.DestDb.Close()
-
-	fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Begin Sync...")
-
-	// Execute SQL
-	numOk := 0
-	numFailed := 0
-	syncRet.Ret = 1
-	if globalSet.ExecuteSQL {
-		var ret error = schemaSync.SyncSQL2Dest(strings.Join(gSqlList, ""), gSqlList)
-		if ret != nil {
-			syncRet.Ret = 0
-			numFailed++
-		} else {
-			numOk++
-		}
-
-		logger.Info("all sql execute done, ", numOk, ", failed:", numFailed)
-	}
-
-	fmt.Println(dbSet.Host+"#"+dbSet.DbName, "End Sync！")
-	syncChan <- syncRet
-
-	return
+	setSourceSchema(source)
 }
@@ -0,0 +1,560 @@
+// Plan bundles, the changes computed on one side and applied on an isolated network
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"struct_sync/logger"
+	db "struct_sync/model"
+	"time"
+)
+
+const (
+	bundleVersion      = 1
+	bundleManifestFile = "manifest.json"
+)
+
+// manifest.json of the bundle, the sha256 of every other file
+type bundleManifest struct {
+	Version int            `json:"version"`
+	Created string         `json:"created"`
+	Plans   []*bundleEntry `json:"plans"`
+	Files   []*bundleFile  `json:"files"`
+}
+
+// plan of one dest db in the bundle
+type bundleEntry struct {
+	Dest    string `json:"dest"`
+	Path    string `json:"path"` // plan.json
+	Changes int    `json:"changes"`
+}
+
+type bundleFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// plan.json, the changes of one dest db and the expected state before them
+type bundlePlan struct {
+	Dest                string          `json:"dest"`
+	ForeignKeyChecksOff bool            `json:"foreignKeyChecksOff,omitempty"`
+	PreState            []*tableState   `json:"preState"`
+	Changes             []*bundleChange `json:"changes"`
+}
+
+type tableState struct {
+	Table       string `json:"table"`
+	Fingerprint string `json:"fingerprint"` // empty when the table not exists
+}
+
+// table or object change, executed in order
+type bundleChange struct {
+	Table  string   `json:"table,omitempty"`
+	Object string   `json:"object,omitempty"` // ex: VIEW `v_user`
+	Type   string   `json:"type"`             // create, alter or drop
+	SQL    []string `json:"sql"`
+	Source string   `json:"source,omitempty"` // create table of the source, to verify the table after execute
+}
+
+var bundleSafeName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+/**
+* Fingerprint of the table structure, sha256 of the normalized create table without AUTO_INCREMENT.
+* The column types are normalized, int unsigned of a schema file is same as int(10) unsigned of MySQL 5.7.
+* empty when the table not exists
+ */
+func tableFingerprint(table string, mys *MySchema) string {
+	if nil == mys {
+		return ""
+	}
+	td := tableDefFromSchema(table, mys)
+	for _, col := range td.Columns {
+		col.Type = normalizeColumnType(col.Type)
+	}
+	sum := sha256.Sum256([]byte(td.createSQL()))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+/**
+* Package the changes of the dest dbs (or the dest schema file, git ref, live database of the to dsn)
+* with the pre-state fingerprints and the sha256 manifest into the tar.gz output
+ */
+func CreateBundle(dest, destRef, to, output string) error {
+	if "" == output {
+		return fmt.Errorf("bundle output not set, use -o <file.tar.gz>")
+	}
+
+	loadSourceSchema()
+	var plans []*bundlePlan
+	if "" != dest || "" != destRef {
+		name, destSource, err := loadDestSchema(dest, destRef)
+		if nil != err {
+			return err
+		}
+		plan, objAlters := diffSchemaSource(name, &schemaSource{Tables: gTableList, Objects: gObjectList}, destSource)
+		plans = append(plans, newBundlePlan(name, plan, objAlters, func(table string) *MySchema {
+			return destSource.Tables[table]
+		}))
+	} else {
+		dbSets := globalSet.DestDbList
+		if "" != to {
+			dbSet, err := dbSetFromDSN(to)
+			if nil != err {
+				return fmt.Errorf("invalid -to dsn: %s", err.Error())
+			}
+			dbSets = []*DBSet{dbSet}
+		}
+		for _, dbSet := range dbSets {
+			plan, err := liveBundlePlan(dbSet)
+			if nil != err {
+				return err
+			}
+			plans = append(plans, plan)
+		}
+	}
+
+	data, manifestSum, err := bundleArchive(plans)
+	if nil != err {
+		return err
+	}
+	if err := writeOutput(output, data); nil != err {
+		return err
+	}
+	for _, plan := range plans {
+		fmt.Println("Bundle", plan.Dest, ",", len(plan.Changes), "change(s)")
+	}
+	fmt.Println("Write bundle", output, ", manifest sha256", manifestSum)
+	return nil
+}
+
+/**
+* Plan of a live dest db
+ */
+func liveBundlePlan(dbSet *DBSet) (*bundlePlan, error) {
+	if "" == dbSet.timeout {
+		dbSet.timeout = globalSet.TimeOut
+	}
+	schemaSync := NewSchemaSync(dbSet)
+	if nil == schemaSync {
+		return nil, fmt.Errorf("connect %s failed", dbSet)
+	}
+	defer schemaSync.DestDb.Close()
+
+	plan, objAlters := schemaSync.alterPlan()
+	return newBundlePlan(dbSet.String(), plan, objAlters, func(table string) *MySchema {
+		destSchema, _ := schemaSync.DestDb.GetTableSchema(table)
+		return ParseSchema(destSchema)
+	}), nil
+}
+
+/**
+* Plan of the changes, the pre-state of each source table and each table to drop
+ */
+func newBundlePlan(name string, plan []*TableAlterData, objAlters []*ObjectAlterData, destTable func(table string) *MySchema) *bundlePlan {
+	bp := &bundlePlan{Dest: name, ForeignKeyChecksOff: globalSet.ForeignKeyChecksOff}
+	for _, tr := range newTableRets(name, plan, nil) {
+		bp.PreState = append(bp.PreState, &tableState{Table: tr.Name, Fingerprint: tableFingerprint(tr.Name, destTable(tr.Name))})
+	}
+
+	for _, sd := range plan {
+		change := &bundleChange{Table: sd.Table, Type: sd.Type.String(), SQL: []string{strings.TrimRight(strings.TrimSpace(sd.SQL), ";")}}
+		if nil != gTableList[sd.Table] {
+			change.Source = gTableList[sd.Table].SchemaRaw
+		}
+		bp.Changes = append(bp.Changes, change)
+	}
+	for _, oa := range objAlters {
+		bp.Changes = append(bp.Changes, &bundleChange{Object: oa.Object.String(), Type: oa.Type.String(), SQL: oa.SQL})
+	}
+	return bp
+}
+
+/**
+* tar.gz of the manifest, plan.json and plan.sql (for review) of each dest db, return the manifest sha256
+ */
+func bundleArchive(plans []*bundlePlan) ([]byte, string, error) {
+	manifest := &bundleManifest{Version: bundleVersion, Created: time.Now().Format(time.RFC3339)}
+	files := make(map[string][]byte)
+	var paths []string
+	addFile := func(path string, data []byte) {
+		files[path] = data
+		paths = append(paths, path)
+		manifest.Files = append(manifest.Files, &bundleFile{Path: path, SHA256: sha256Hex(data), Size: len(data)})
+	}
+
+	for i, plan := range plans {
+		dir := fmt.Sprintf("plans/%d_%s/", i+1, strings.Trim(bundleSafeName.ReplaceAllString(plan.Dest, "_"), "_"))
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if nil != err {
+			return nil, "", err
+		}
+		addFile(dir+"plan.json", data)
+		addFile(dir+"plan.sql", []byte(plan.script()))
+		manifest.Plans = append(manifest.Plans, &bundleEntry{Dest: plan.Dest, Path: dir + "plan.json", Changes: len(plan.Changes)})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if nil != err {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, path := range append([]string{bundleManifestFile}, paths...) {
+		data := manifestData
+		if bundleManifestFile != path {
+			data = files[path]
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0644, Size: int64(len(data)), ModTime: now}); nil != err {
+			return nil, "", err
+		}
+		if _, err := tw.Write(data); nil != err {
+			return nil, "", err
+		}
+	}
+	if err := tw.Close(); nil != err {
+		return nil, "", err
+	}
+	if err := gz.Close(); nil != err {
+		return nil, "", err
+	}
+	return buf.Bytes(), sha256Hex(manifestData), nil
+}
+
+/**
+* Sql script of the plan, with the pre-state as comments
+ */
+func (bp *bundlePlan) script() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "-- %s\n-- Pre-state fingerprints:\n", bp.Dest)
+	for _, state := range bp.PreState {
+		fingerprint := state.Fingerprint
+		if "" == fingerprint {
+			fingerprint = "(not exists)"
+		}
+		fmt.Fprintf(&buf, "--   %s %s\n", state.Table, fingerprint)
+	}
+	if bp.ForeignKeyChecksOff {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	}
+	for _, change := range bp.Changes {
+		name := "TABLE `" + change.Table + "`"
+		if "" != change.Object {
+			name = change.Object
+		}
+		fmt.Fprintf(&buf, "\n-- %s : %s\n", name, change.Type)
+		if "" != change.Object && strings.Contains(strings.Join(change.SQL, "\n"), ";") { // routine and trigger body
+			buf.WriteString("DELIMITER ;;\n")
+			for _, sql := range change.SQL {
+				buf.WriteString(sql + ";;\n")
+			}
+			buf.WriteString("DELIMITER ;\n")
+			continue
+		}
+		for _, sql := range change.SQL {
+			buf.WriteString(sql + ";\n")
+		}
+	}
+	if bp.ForeignKeyChecksOff {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+	return buf.String()
+}
+
+/**
+* Read the bundle and verify the files by the manifest, return the plans and the manifest sha256
+ */
+func readBundle(path string) ([]*bundlePlan, string, error) {
+	data, err := readInput(path)
+	if nil != err {
+		return nil, "", err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if nil != err {
+		return nil, "", fmt.Errorf("not a bundle: %s", err.Error())
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			return nil, "", fmt.Errorf("read bundle failed: %s", err.Error())
+		}
+		if tar.TypeReg != header.Typeflag {
+			continue
+		}
+		if files[header.Name], err = ioutil.ReadAll(tr); nil != err {
+			return nil, "", fmt.Errorf("read bundle failed: %s", err.Error())
+		}
+	}
+
+	manifestData, has := files[bundleManifestFile]
+	if !has {
+		return nil, "", fmt.Errorf("%s not found in the bundle", bundleManifestFile)
+	}
+	manifest := &bundleManifest{}
+	if err := json.Unmarshal(manifestData, manifest); nil != err {
+		return nil, "", fmt.Errorf("invalid %s: %s", bundleManifestFile, err.Error())
+	}
+	if manifest.Version != bundleVersion {
+		return nil, "", fmt.Errorf("unsupported bundle version %d", manifest.Version)
+	}
+
+	// Every file is in the manifest with the same sha256
+	listed := map[string]bool{bundleManifestFile: true}
+	for _, file := range manifest.Files {
+		listed[file.Path] = true
+		content, has := files[file.Path]
+		if !has {
+			return nil, "", fmt.Errorf("%s of the manifest not found in the bundle", file.Path)
+		}
+		if len(content) != file.Size || sha256Hex(content) != file.SHA256 {
+			return nil, "", fmt.Errorf("%s sha256 mismatch, the bundle is modified or broken", file.Path)
+		}
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, "", fmt.Errorf("%s is not in the manifest", name)
+		}
+	}
+
+	var plans []*bundlePlan
+	for _, entry := range manifest.Plans {
+		if !listed[entry.Path] || bundleManifestFile == entry.Path {
+			return nil, "", fmt.Errorf("plan %s of %s is not in the manifest", entry.Path, entry.Dest)
+		}
+		plan := &bundlePlan{}
+		if err := json.Unmarshal(files[entry.Path], plan); nil != err {
+			return nil, "", fmt.Errorf("invalid %s: %s", entry.Path, err.Error())
+		}
+		plans = append(plans, plan)
+	}
+	return plans, sha256Hex(manifestData), nil
+}
+
+/**
+* Verify the bundle, then check the pre-state of each dest db (the to dsn, or DestDbList by name) and execute its plan
+ */
+func ApplyBundle(path, to string) ([]SyncRet, error) {
+	if "" == path {
+		return nil, fmt.Errorf("bundle not set, use -bundle <file.tar.gz>")
+	}
+	plans, manifestSum, err := readBundle(path)
+	if nil != err {
+		return nil, err
+	}
+	fmt.Println("Bundle verified, manifest sha256", manifestSum)
+
+	dbSets := globalSet.DestDbList
+	if "" != to {
+		dbSet, err := dbSetFromDSN(to)
+		if nil != err {
+			return nil, fmt.Errorf("invalid -to dsn: %s", err.Error())
+		}
+		dbSets = []*DBSet{dbSet}
+	}
+
+	// Plan of each dest db by name, the only plan for the only dest db
+	var rets []SyncRet
+	for index, dbSet := range dbSets {
+		var plan *bundlePlan
+		for _, p := range plans {
+			if p.Dest == dbSet.String() {
+				plan = p
+			}
+		}
+		if nil == plan && len(plans) == 1 && len(dbSets) == 1 {
+			plan = plans[0]
+		}
+		if nil == plan {
+			fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Skip, no plan in the bundle")
+			rets = append(rets, SyncRet{Id: strconv.Itoa(index), DbName: dbSet.String(), Ret: syncRetSkipped, Msg: "no plan in the bundle"})
+			continue
+		}
+		if "" == dbSet.timeout {
+			dbSet.timeout = globalSet.TimeOut
+		}
+		ret := applyPlan(dbSet, plan, strconv.Itoa(index))
+		logger.Info(ret)
+		rets = append(rets, ret)
+	}
+
+	printSyncSummary(rets)
+	writeJUnitReport(rets)
+	return rets, nil
+}
+
+/**
+* Check the pre-state of the dest db, execute the changes and verify the tables
+ */
+func applyPlan(dbSet *DBSet, plan *bundlePlan, id string) SyncRet {
+	syncRet := SyncRet{Id: id, DbName: dbSet.String(), Ret: syncRetFailed, Changes: len(plan.Changes)}
+	// The settings of this plan only
+	foreignKeyChecksOff, tableList := globalSet.ForeignKeyChecksOff, gTableList
+	defer func() {
+		globalSet.ForeignKeyChecksOff, gTableList = foreignKeyChecksOff, tableList
+	}()
+	globalSet.ForeignKeyChecksOff = foreignKeyChecksOff || plan.ForeignKeyChecksOff
+
+	schemaSync := NewSchemaSync(dbSet)
+	if nil == schemaSync {
+		fmt.Println(dbSet.Host, dbSet.DbName, "Database connection fail")
+		syncRet.Msg = "database connection fail"
+		return syncRet
+	}
+	defer schemaSync.DestDb.Close()
+	fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Begin Apply", plan.Dest, "...")
+
+	// Expected source of the changed tables, for the diff and the verify
+	source := make(map[string]*MySchema)
+	for _, change := range plan.Changes {
+		if "" != change.Table && "" != change.Source {
+			source[change.Table] = parseSchemaWithFields(change.Source)
+		}
+	}
+	gTableList = source
+
+	// All the changes of a table, two for a table of a foreign key cycle
+	changes := make(map[string][]*bundleChange)
+	for _, change := range plan.Changes {
+		if "" != change.Table {
+			changes[change.Table] = append(changes[change.Table], change)
+		}
+	}
+
+	// Pre-state, each table as when the bundle was created
+	var mismatch []string
+	for _, state := range plan.PreState {
+		destSchema, _ := schemaSync.DestDb.GetTableSchema(state.Table)
+		dest := ParseSchema(destSchema)
+		tr := &TableRet{Name: state.Table, Type: alterTypeNo}
+		if tableChanges := changes[state.Table]; len(tableChanges) > 0 {
+			var types []AlterType
+			var sqls []string
+			for _, change := range tableChanges {
+				types = append(types, parseAlterType(change.Type))
+				sqls = append(sqls, change.SQL...)
+			}
+			tr.Type = tableAlterType(types)
+			tr.SQL = strings.Join(sqls, ";\n") + ";\n"
+			fromName, toName, from, to := dbSet.String()+"/"+state.Table, "source/"+state.Table, "", ""
+			if nil != dest {
+				from = dest.SchemaRawNoInc
+			} else {
+				fromName = "/dev/null"
+			}
+			if nil != source[state.Table] {
+				to = source[state.Table].SchemaRawNoInc
+			} else {
+				toName = "/dev/null"
+			}
+			tr.Diff = unifiedDiff(fromName, toName, from, to)
+		}
+		syncRet.Tables = append(syncRet.Tables, tr)
+
+		if fingerprint := tableFingerprint(state.Table, dest); fingerprint != state.Fingerprint {
+			switch {
+			case "" == state.Fingerprint:
+				mismatch = append(mismatch, fmt.Sprintf("`%s` exists", state.Table))
+			case "" == fingerprint:
+				mismatch = append(mismatch, fmt.Sprintf("`%s` not exists", state.Table))
+			default:
+				mismatch = append(mismatch, fmt.Sprintf("`%s` changed", state.Table))
+			}
+		}
+	}
+	for _, change := range plan.Changes {
+		if "" != change.Object {
+			syncRet.Tables = append(syncRet.Tables, &TableRet{Name: change.Object, Type: parseAlterType(change.Type),
+				SQL: strings.Join(change.SQL, ";\n") + ";\n"})
+		}
+	}
+
+	if len(mismatch) > 0 {
+		syncRet.Ret = syncRetSkipped
+		syncRet.Msg = "pre-state mismatch: " + strings.Join(mismatch, ", ")
+		schemaSync.addErrorLog("applyPlan", "[BUNDLE.PRESTATE] "+syncRet.Msg)
+		fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Skip Apply,", syncRet.Msg)
+		return syncRet
+	}
+	schemaSync.addInfoLog("applyPlan", fmt.Sprint("[BUNDLE.PRESTATE] ", len(plan.PreState), " table(s) match"))
+
+	syncRet.Ret = syncRetSucceed
+	if !globalSet.ExecuteSQL {
+		fmt.Println(dbSet.Host+"#"+dbSet.DbName, "Pre-state verified, not executed")
+		return syncRet
+	}
+
+	numOk, numFailed, numTimeout, numCanceled := 0, 0, 0, 0
+	var applied []*TableAlterData
+	tableRets := syncRet.tableRetMap()
+	for _, change := range plan.Changes {
+		var ret error
+		for _, sql := range change.SQL {
+			if ret = schemaSync.SyncSQL2Dest(sql, nil); nil != ret {
+				break
+			}
+		}
+
+		name := change.Table
+		if "" != change.Object {
+			name = change.Object
+		}
+		tr := tableRets[name]
+		if ret == nil {
+			numOk++
+			tr.Applied = true
+			if "" != change.Table {
+				applied = append(applied, &TableAlterData{Table: change.Table, Type: tr.Type})
+			}
+		} else if db.IsTimeout(ret) {
+			numTimeout++
+			tr.Err = "timeout: " + ret.Error()
+		} else if db.IsCanceled(ret) {
+			numCanceled++
+			tr.Err = ret.Error()
+		} else {
+			numFailed++
+			tr.Err = ret.Error()
+		}
+	}
+	syncRet.setExecuted(numOk, numFailed, numTimeout, numCanceled)
+	syncRet.setDrift(schemaSync.verifyTables(applied))
+
+	fmt.Println(dbSet.Host+"#"+dbSet.DbName, "End Apply！")
+	return syncRet
+}
+
+/**
+* Alter type of AlterType.String()
+ */
+func parseAlterType(name string) AlterType {
+	for _, at := range []AlterType{alterTypeCreate, alterTypeAlter, alterTypeDrop} {
+		if at.String() == name {
+			return at
+		}
+	}
+	return alterTypeNo
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTableFingerprint(t *testing.T) {
+	file := ParseSchema("CREATE TABLE `user` (\n  `id` int unsigned NOT NULL,\n  `ok` bool DEFAULT 0,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB")
+	live := ParseSchema("CREATE TABLE `user` (\n  `id` int(10) unsigned NOT NULL,\n  `ok` tinyint(1) DEFAULT '0',\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB")
+	if tableFingerprint("user", file) != tableFingerprint("user", live) {
+		t.Errorf("fingerprint of the schema file differs from the live table")
+	}
+
+	changed := ParseSchema("CREATE TABLE `user` (\n  `id` bigint unsigned NOT NULL,\n  `ok` bool DEFAULT 0,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB")
+	if tableFingerprint("user", file) == tableFingerprint("user", changed) {
+		t.Errorf("fingerprint of a changed table is same")
+	}
+}
+
+func TestReadBundleModified(t *testing.T) {
+	plan := &bundlePlan{Dest: "shop@127.0.0.1#3306", Changes: []*bundleChange{{Table: "a", Type: "create", SQL: []string{"CREATE TABLE a (id int)"}}}}
+	data, _, err := bundleArchive([]*bundlePlan{plan})
+	if nil != err {
+		t.Fatalf("bundleArchive() error: %v", err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); nil != err {
+			t.Fatal(err)
+		}
+		return path
+	}
+	if plans, _, err := readBundle(write("ok.tar.gz", data)); nil != err || len(plans) != 1 {
+		t.Fatalf("readBundle() = %v, %v", plans, err)
+	}
+
+	tests := []struct {
+		name    string
+		rewrite func(name string, content []byte) []byte
+		extra   string
+		wantErr string
+	}{
+		{
+			name: "changed file",
+			rewrite: func(name string, content []byte) []byte {
+				if strings.HasSuffix(name, "plan.sql") {
+					return bytes.Replace(content, []byte("CREATE TABLE a"), []byte("DROP TABLE b; CREATE TABLE a"), 1)
+				}
+				return content
+			},
+			wantErr: "sha256 mismatch",
+		},
+		{
+			name:    "added file",
+			extra:   "plans/1_shop/extra.sql",
+			wantErr: "plans/1_shop/extra.sql is not in the manifest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := rewriteBundle(t, data, tt.rewrite, tt.extra)
+			_, _, err := readBundle(write(strings.Replace(tt.name, " ", "_", -1)+".tar.gz", modified))
+			if nil == err || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readBundle() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+/**
+* Copy of the bundle with the files rewritten and an extra file
+ */
+func rewriteBundle(t *testing.T, data []byte, rewrite func(name string, content []byte) []byte, extra string) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if nil != err {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	add := func(name string, content []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); nil != err {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		if nil != rewrite {
+			content = rewrite(header.Name, content)
+		}
+		add(header.Name, content)
+	}
+	if "" != extra {
+		add(extra, []byte("DROP DATABASE shop;\n"))
+	}
+	tw.Close()
+	gzw.Close()
+	return buf.Bytes()
+}
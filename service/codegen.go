@@ -0,0 +1,342 @@
+// Go model code generation
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"struct_sync/logger"
+)
+
+// first line of the generated files
+const codegenHeader = "// Code generated by StructSync. DO NOT EDIT."
+
+// file name suffixes with special meaning to go build
+var buildSuffixes = []string{"test", "linux", "windows", "darwin", "freebsd", "netbsd", "openbsd", "android", "ios", "js",
+	"wasip1", "plan9", "solaris", "aix", "illumos", "dragonfly", "386", "amd64", "arm", "arm64", "wasm", "riscv64",
+	"loong64", "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le", "s390x"}
+
+// upper case words in go names
+var commonInitialisms = []string{"ID", "URL", "URI", "API", "HTTP", "HTTPS", "IP", "JSON", "XML", "UUID", "SQL", "UID", "UI", "DB"}
+
+/**
+* Generate one go file per table of the source schema, with the tag styles (db, json, gorm)
+ */
+func GenerateModels(output, pkg string, tags []string) error {
+	if "" == output || stdioPath == output {
+		return fmt.Errorf("codegen output not set, use -o <dir>")
+	}
+	if "" == pkg {
+		pkg = filepath.Base(output)
+	}
+	for _, tag := range tags {
+		if !inStringSlice(tag, []string{"db", "json", "gorm"}) {
+			return fmt.Errorf("unsupported tag style [%s], use db, json or gorm", tag)
+		}
+	}
+
+	loadSourceSchema()
+	if err := os.MkdirAll(output, os.ModePerm); nil != err {
+		return err
+	}
+
+	// Struct and file names are unique in the package, ex: user_info and UserInfo -> UserInfo and UserInfo2
+	files := make(map[string]bool)
+	codes := make(map[string][]byte)
+	structNames := make(map[string]bool)
+	fileNames := make(map[string]bool)
+	for _, table := range sortedTableNames(gTableList) {
+		td := tableDefFromSchema(table, gTableList[table])
+		structName := uniqueName(goName(table), structNames)
+		if structName != goName(table) {
+			logger.Warn(fmt.Sprintf("Codegen: struct of table %s renamed to %s", table, structName))
+		}
+		code, err := modelCode(td, pkg, structName, tags)
+		if nil != err {
+			return fmt.Errorf("table `%s`: %s", table, err.Error())
+		}
+
+		fileName := filepath.Join(output, uniqueName(goFileName(structName), fileNames)+".go")
+		files[fileName] = true
+		codes[fileName] = code
+	}
+	if err := typeCheckModels(pkg, codes); nil != err {
+		return err
+	}
+	for fileName, code := range codes {
+		if err := ioutil.WriteFile(fileName, code, 0644); nil != err {
+			return err
+		}
+	}
+
+	// Remove the generated files of the dropped tables
+	oldFiles, _ := filepath.Glob(filepath.Join(output, "*.go"))
+	for _, file := range oldFiles {
+		if files[file] {
+			continue
+		}
+		if data, err := ioutil.ReadFile(file); nil == err && strings.HasPrefix(string(data), codegenHeader) {
+			if err := os.Remove(file); nil != err {
+				return err
+			}
+		}
+	}
+
+	fmt.Println("Generate models to", output, ",", len(files), "tables")
+	return nil
+}
+
+/**
+* Go source of the table struct
+ */
+func modelCode(td *tableDef, pkg, structName string, tags []string) ([]byte, error) {
+	primary, unique := keyColumns(td)
+
+	var body bytes.Buffer
+	needTime := false
+	fieldNames := map[string]bool{"TableName": true} // the method
+	if "" != td.Comment {
+		fmt.Fprintf(&body, "// %s %s\n", structName, oneLine(td.Comment))
+	} else {
+		fmt.Fprintf(&body, "// %s table %s\n", structName, td.Name)
+	}
+	fmt.Fprintf(&body, "type %s struct {\n", structName)
+	for _, col := range td.Columns {
+		goType := columnGoType(col)
+		if strings.HasSuffix(goType, "time.Time") {
+			needTime = true
+		}
+
+		if "" != col.Comment {
+			fmt.Fprintf(&body, "\t// %s\n", oneLine(col.Comment))
+		}
+		fieldName := uniqueName(goName(col.Name), fieldNames)
+		if fieldName != goName(col.Name) {
+			logger.Warn(fmt.Sprintf("Codegen: field of column %s.%s renamed to %s", td.Name, col.Name, fieldName))
+		}
+		fmt.Fprintf(&body, "\t%s %s `%s`\n", fieldName, goType, fieldTags(col, tags, primary, unique[col.Name]))
+	}
+	body.WriteString("}\n\n")
+	fmt.Fprintf(&body, "// TableName of %s\nfunc (%s) TableName() string {\n\treturn %q\n}\n", structName, structName, td.Name)
+
+	var code bytes.Buffer
+	fmt.Fprintf(&code, "%s\n\npackage %s\n\n", codegenHeader, pkg)
+	if needTime {
+		code.WriteString("import \"time\"\n\n")
+	}
+	code.Write(body.Bytes())
+	return format.Source(code.Bytes())
+}
+
+/**
+* Name not used yet, with a number suffix when taken, ex: UserID, UserID2
+ */
+func uniqueName(name string, used map[string]bool) string {
+	unique := name
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s%d", name, n)
+	}
+	used[unique] = true
+	return unique
+}
+
+/**
+* Type check the generated files as one package, format.Source only parses them
+ */
+func typeCheckModels(pkg string, codes map[string][]byte) error {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for fileName, code := range codes {
+		file, err := parser.ParseFile(fset, filepath.Base(fileName), code, 0)
+		if nil != err {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	conf := types.Config{Importer: modelImporter{}}
+	if _, err := conf.Check(pkg, fset, files, nil); nil != err {
+		return fmt.Errorf("generated models don't compile: %s", err.Error())
+	}
+	return nil
+}
+
+// Importer of the generated models, the only import is time.Time
+type modelImporter struct{}
+
+func (modelImporter) Import(path string) (*types.Package, error) {
+	if "time" != path {
+		return nil, fmt.Errorf("unexpected import %s", path)
+	}
+	pkg := types.NewPackage("time", "time")
+	name := types.NewTypeName(token.NoPos, pkg, "Time", nil)
+	types.NewNamed(name, types.NewStruct(nil, nil), nil)
+	pkg.Scope().Insert(name)
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+/**
+* Primary key columns and the unique index names of each column
+ */
+func keyColumns(td *tableDef) (map[string]bool, map[string][]string) {
+	primary := make(map[string]bool)
+	unique := make(map[string][]string)
+	for _, idx := range td.Indexes {
+		for _, col := range idx.Columns {
+			if p := strings.Index(col, "("); p > 0 {
+				col = col[:p]
+			}
+			if "PRIMARY" == idx.Kind {
+				primary[col] = true
+			} else if "UNIQUE" == idx.Kind {
+				unique[col] = append(unique[col], idx.Name)
+			}
+		}
+	}
+	return primary, unique
+}
+
+/**
+* Struct tag of the column
+ */
+func fieldTags(col *columnDef, tags []string, primary map[string]bool, uniques []string) string {
+	var items []string
+	for _, tag := range tags {
+		switch tag {
+		case "db", "json":
+			items = append(items, fmt.Sprintf("%s:%q", tag, tagValue(col.Name)))
+		case "gorm":
+			settings := []string{"column:" + gormValue(col.Name), "type:" + gormValue(col.Type)}
+			if primary[col.Name] {
+				settings = append(settings, "primaryKey")
+			}
+			if col.AutoIncrement {
+				settings = append(settings, "autoIncrement")
+			}
+			if col.NotNull && !primary[col.Name] {
+				settings = append(settings, "not null")
+			}
+			if nil != col.Default && "" == *col.Default {
+				settings = append(settings, "default:''")
+			} else if nil != col.Default {
+				settings = append(settings, "default:"+gormValue(*col.Default))
+			}
+			for _, name := range uniques {
+				settings = append(settings, "uniqueIndex:"+gormValue(name))
+			}
+			if "" != col.Comment {
+				settings = append(settings, "comment:"+gormValue(oneLine(col.Comment)))
+			}
+			items = append(items, fmt.Sprintf("gorm:%q", tagValue(strings.Join(settings, ";"))))
+		}
+	}
+	return strings.Join(items, " ")
+}
+
+/**
+* Struct tag value, the raw string literal of the tag can't hold a backtick
+ */
+func tagValue(value string) string {
+	return strings.Replace(value, "`", "'", -1)
+}
+
+/**
+* Value of a gorm tag setting, ; is escaped as gorm does
+ */
+func gormValue(value string) string {
+	return strings.Replace(value, ";", "\\;", -1)
+}
+
+/**
+* Go type of the column, pointer when nullable
+ */
+func columnGoType(col *columnDef) string {
+	colType := strings.ToLower(col.Type)
+	unsigned := strings.Contains(colType, "unsigned")
+	baseType := colType
+	if p := strings.IndexAny(baseType, "( "); p > 0 {
+		baseType = baseType[:p]
+	}
+
+	var goType string
+	switch baseType {
+	case "tinyint":
+		goType = "int8"
+		if strings.HasPrefix(colType, "tinyint(1)") {
+			goType = "bool"
+		}
+	case "smallint", "year":
+		goType = "int16"
+	case "mediumint", "int", "integer":
+		goType = "int32"
+	case "bigint":
+		goType = "int64"
+	case "float":
+		goType = "float32"
+	case "double", "real":
+		goType = "float64"
+	case "date", "datetime", "timestamp":
+		goType = "time.Time"
+	case "bit":
+		goType = "uint64"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		goType = "[]byte"
+	default: // char, text, decimal, enum, set, json, time
+		goType = "string"
+	}
+	if unsigned && strings.HasPrefix(goType, "int") {
+		goType = "u" + goType
+	}
+
+	if !col.NotNull && "[]byte" != goType {
+		goType = "*" + goType
+	}
+	return goType
+}
+
+/**
+* Snake case to go name, ex: user_id -> UserID
+ */
+func goName(name string) string {
+	var buf strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if upper := strings.ToUpper(word); inStringSlice(upper, commonInitialisms) {
+			buf.WriteString(upper)
+		} else {
+			buf.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+
+	goName := buf.String()
+	if "" == goName || (goName[0] >= '0' && goName[0] <= '9') {
+		goName = "T" + goName
+	}
+	return goName
+}
+
+/**
+* File name of the struct without .go, ex: UserInfo -> user_info
+ */
+func goFileName(structName string) string {
+	name := strings.ToLower(snakeCase(structName))
+	parts := strings.Split(name, "_")
+	if len(parts) > 1 && inStringSlice(parts[len(parts)-1], buildSuffixes) { // not a test or build constraint file
+		name += "_"
+	}
+	return name
+}
+
+func oneLine(str string) string {
+	return strings.Join(strings.Fields(str), " ")
+}
@@ -0,0 +1,287 @@
+// Views, routines and triggers
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	db "struct_sync/model"
+)
+
+const (
+	objectTypeView      = "VIEW"
+	objectTypeProcedure = "PROCEDURE"
+	objectTypeFunction  = "FUNCTION"
+	objectTypeTrigger   = "TRIGGER"
+)
+
+// object types, in create order
+var objectTypes = []string{objectTypeView, objectTypeProcedure, objectTypeFunction, objectTypeTrigger}
+
+var definerReg = regexp.MustCompile("DEFINER\\s*=\\s*(`[^`]*`|'[^']*'|[^ @]+)@(`[^`]*`|'[^']*'|[^ ]+) ")
+
+var orReplaceReg = regexp.MustCompile(`(?i)^CREATE\s+OR\s+REPLACE\s+`)
+
+var objectCreateReg = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:ALGORITHM\s*=\s*\w+\s+)?` +
+	`(?:DEFINER\s*=\s*\S+\s+)?(?:SQL\s+SECURITY\s+\w+\s+)?(?:AGGREGATE\s+)?` +
+	`(VIEW|PROCEDURE|FUNCTION|TRIGGER)\s+(?:IF\s+NOT\s+EXISTS\s+)?`)
+
+// view, procedure, function or trigger
+type DbObject struct {
+	Type string
+	Name string
+	SQL  string // create sql, without DEFINER
+}
+
+func (obj *DbObject) String() string {
+	return fmt.Sprintf("%s `%s`", obj.Type, obj.Name)
+}
+
+/**
+* Create sql with delimiter, routine and trigger body has ';'
+ */
+func (obj *DbObject) delimitedSQL() string {
+	if obj.Type == objectTypeView {
+		return obj.SQL + ";\n"
+	}
+	return "DELIMITER ;;\n" + obj.SQL + ";;\nDELIMITER ;\n"
+}
+
+/**
+* Query the objects of the database, sorted by type and name
+ */
+func getDbObjects(mysqlDb *db.MysqlDb) ([]*DbObject, error) {
+	var objects []*DbObject
+	for _, objType := range objectTypes {
+		names, err := mysqlDb.GetObjectNames(objType)
+		if nil != err {
+			return nil, err
+		}
+
+		sortStrings(names)
+		for _, name := range names {
+			schema, err := mysqlDb.GetObjectSchema(objType, name)
+			if nil != err {
+				return nil, err
+			}
+			objects = append(objects, &DbObject{Type: objType, Name: name, SQL: normalizeObjectSQL(schema)})
+		}
+	}
+	return objects, nil
+}
+
+/**
+* Remove DEFINER, it is different between servers
+ */
+func normalizeObjectSQL(sql string) string {
+	sql = definerReg.ReplaceAllString(strings.TrimSpace(sql), "")
+	sql = orReplaceReg.ReplaceAllString(sql, "CREATE ")
+	return strings.TrimRight(sql, ";")
+}
+
+/**
+* Parser create view, procedure, function or trigger statement, nil when it is not
+ */
+func parseObjectStatement(stmt string) *DbObject {
+	loc := objectCreateReg.FindStringSubmatchIndex(stmt)
+	if nil == loc {
+		return nil
+	}
+
+	rest := strings.TrimSpace(stmt[loc[1]:])
+	dbName, name, n := readQualifiedName(rest)
+	if "" == name {
+		return nil
+	}
+	objType := strings.ToUpper(stmt[loc[2]:loc[3]])
+
+	// One space between the keywords (mysqldump splits them into conditional comments), without db of the name
+	sql := collapseSpace(stmt[:loc[1]]) + " "
+	if "" != dbName {
+		sql += "`" + strings.Replace(name, "`", "``", -1) + "`" + rest[n:]
+	} else {
+		sql += rest
+	}
+
+	return &DbObject{
+		Type: objType,
+		Name: name,
+		SQL:  normalizeObjectSQL(sql),
+	}
+}
+
+/**
+* Sort objects by type and name
+ */
+func sortObjects(objects []*DbObject) {
+	typeOrder := make(map[string]int, len(objectTypes))
+	for i, objType := range objectTypes {
+		typeOrder[objType] = i
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Type != objects[j].Type {
+			return typeOrder[objects[i].Type] < typeOrder[objects[j].Type]
+		}
+		return objects[i].Name < objects[j].Name
+	})
+}
+
+// change of a view, routine or trigger
+type ObjectAlterData struct {
+	Object *DbObject
+	Old    *DbObject // dest object replaced by alter
+	Type   AlterType
+	SQL    []string // statements in execute order
+}
+
+/**
+* Statements for the sql file, routine and trigger use DELIMITER
+ */
+func (oa *ObjectAlterData) fileSQL() string {
+	var buf strings.Builder
+	for _, sql := range oa.SQL {
+		if sql == oa.Object.SQL {
+			buf.WriteString(oa.Object.delimitedSQL())
+		} else {
+			buf.WriteString(sql + ";\n")
+		}
+	}
+	return buf.String()
+}
+
+/**
+* Compare the source objects with the dest db
+ */
+func (sc *SchemaSync) getObjectAlters() []*ObjectAlterData {
+	destObjects, err := getDbObjects(sc.DestDb)
+	if nil != err {
+		sc.addErrorLog("getObjectAlters", fmt.Sprint("Query dest objects failed: ", err.Error()))
+		return nil
+	}
+	return sc.diffObjects(gObjectList, destObjects, sc.serverViewSQL(gObjectList, destObjects))
+}
+
+/**
+* Create sql of the changed source views as the dest server shows them, by object.
+* SHOW CREATE VIEW adds ALGORITHM and SQL SECURITY and rewrites the select list, so the source views are created
+* in a shadow database with the source tables and read back. nil when it fails, the views are compared as written
+ */
+func (sc *SchemaSync) serverViewSQL(source, dest []*DbObject) map[string]string {
+	destSQL := make(map[string]string, len(dest))
+	for _, obj := range dest {
+		destSQL[obj.String()] = obj.SQL
+	}
+	var views, changed []*DbObject
+	for _, obj := range source {
+		if obj.Type != objectTypeView {
+			continue
+		}
+		views = append(views, obj)
+		if sql, has := destSQL[obj.String()]; has && collapseSpace(sql) != collapseSpace(obj.SQL) {
+			changed = append(changed, obj)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	shadow, err := sc.createShadowDatabase("serverViewSQL")
+	if nil != err {
+		sc.addWarnLog("serverViewSQL", "Compare the views as written, "+err.Error())
+		return nil
+	}
+	defer sc.dropShadowDatabase("serverViewSQL", shadow)
+	shadowDb, err := shadow.connect(true)
+	if nil != err {
+		sc.addWarnLog("serverViewSQL", "Compare the views as written, "+err.Error())
+		return nil
+	}
+	defer shadowDb.Close()
+
+	for table, schema := range gTableList {
+		if _, err := shadowDb.SqlExec(schema.SchemaRaw); nil != err {
+			sc.addWarnLog("serverViewSQL", fmt.Sprintf("Compare the views as written, create table `%s`: %s", table, err.Error()))
+			return nil
+		}
+	}
+
+	// A view may select from the views after it, create the failed ones again until no one is created
+	for pending := views; len(pending) > 0; {
+		var failed []*DbObject
+		for _, obj := range pending {
+			if _, err := shadowDb.SqlExec(obj.SQL); nil != err {
+				failed = append(failed, obj)
+			}
+		}
+		if len(failed) == len(pending) {
+			break
+		}
+		pending = failed
+	}
+
+	sqls := make(map[string]string, len(changed))
+	for _, obj := range changed {
+		schema, err := shadowDb.GetObjectSchema(objectTypeView, obj.Name)
+		if nil != err || "" == schema {
+			sc.addWarnLog("serverViewSQL", fmt.Sprint("Compare ", obj, " as written, it is not created in the shadow database"))
+			continue
+		}
+		sqls[obj.String()] = normalizeObjectSQL(strings.Replace(schema, "`"+shadow.name+"`.", "", -1))
+	}
+	return sqls
+}
+
+/**
+* Compare the source objects with the dest objects.
+* serverSQL: create sql of the source objects as the dest server shows them, compared instead of the source sql
+ */
+func (sc *SchemaSync) diffObjects(source, dest []*DbObject, serverSQL map[string]string) []*ObjectAlterData {
+	destObjects := make(map[string]*DbObject, len(dest))
+	for _, obj := range dest {
+		destObjects[obj.String()] = obj
+	}
+
+	var alters []*ObjectAlterData
+	sourceNames := make(map[string]bool, len(source))
+	for _, obj := range source {
+		sourceNames[obj.String()] = true
+
+		old, has := destObjects[obj.String()]
+		sql, normalized := serverSQL[obj.String()]
+		if !normalized {
+			sql = obj.SQL
+		}
+		if has && collapseSpace(old.SQL) == collapseSpace(sql) {
+			sc.addInfoLog("diffObjects", fmt.Sprint("[OBJECT.ALTER] ", obj, " Same"))
+			continue
+		}
+
+		alter := &ObjectAlterData{Object: obj, Type: alterTypeCreate}
+		if has {
+			alter.Type = alterTypeAlter
+			alter.Old = old
+			alter.SQL = append(alter.SQL, obj.dropSQL())
+		}
+		alter.SQL = append(alter.SQL, obj.SQL)
+		alters = append(alters, alter)
+		sc.addWarnLog("diffObjects", fmt.Sprint("[OBJECT.", strings.ToUpper(alter.Type.String()), "] ", obj))
+	}
+
+	// Delete objects that are not in the source
+	if globalSet.DropUnecessary {
+		for _, obj := range dest {
+			if !sourceNames[obj.String()] {
+				alters = append(alters, &ObjectAlterData{Object: obj, Type: alterTypeDrop, SQL: []string{obj.dropSQL()}})
+				sc.addWarnLog("diffObjects", fmt.Sprint("[OBJECT.DROP] ", obj))
+			}
+		}
+	}
+
+	return alters
+}
+
+func (obj *DbObject) dropSQL() string {
+	return fmt.Sprintf("DROP %s IF EXISTS `%s`", obj.Type, obj.Name)
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestDiffObjectsServerSQL(t *testing.T) {
+	globalSet = &GlobalSet{}
+	sc := &SchemaSync{DbSet: &DBSet{DbName: "shop", Host: "127.0.0.1"}}
+
+	source := []*DbObject{parseObjectStatement("CREATE VIEW v AS SELECT id, name FROM user")}
+	dest := []*DbObject{{Type: objectTypeView, Name: "v", SQL: normalizeObjectSQL("CREATE ALGORITHM=UNDEFINED " +
+		"DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `v` AS select `user`.`id` AS `id`,`user`.`name` AS `name` from `user`")}}
+
+	if alters := sc.diffObjects(source, dest, nil); len(alters) != 1 || alters[0].Type != alterTypeAlter {
+		t.Errorf("diffObjects() as written = %+v, want one alter", alters)
+	}
+
+	// The source view as the server shows it
+	serverSQL := map[string]string{"VIEW `v`": dest[0].SQL}
+	if alters := sc.diffObjects(source, dest, serverSQL); len(alters) != 0 {
+		t.Errorf("diffObjects() = %+v, want no change", alters)
+	}
+
+	serverSQL["VIEW `v`"] += " where (`user`.`id` > 1)"
+	alters := sc.diffObjects(source, dest, serverSQL)
+	if len(alters) != 1 || alters[0].SQL[1] != source[0].SQL {
+		t.Errorf("diffObjects() = %+v, want the source view created as written", alters)
+	}
+}
@@ -0,0 +1,352 @@
+// ER diagram of the source schema by the foreign keys, Graphviz DOT and Mermaid
+package service
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DiagramFormatDot     = "dot"     // Graphviz digraph
+	DiagramFormatMermaid = "mermaid" // Mermaid erDiagram
+)
+
+// Supported diagram formats
+var DiagramFormats = []string{DiagramFormatDot, DiagramFormatMermaid}
+
+/**
+* Write the ER diagram of the source schema to output (default stdout).
+* table: only the tables within depth foreign keys of it, pattern: only the tables matching one of the comma separated globs
+ */
+func GenerateDiagram(output, format, table string, depth int, pattern string) error {
+	if "" == format {
+		format = diagramFormatOf(output)
+	}
+	if !inStringSlice(format, DiagramFormats) {
+		return fmt.Errorf("unknown diagram format [%s], use dot or mermaid", format)
+	}
+
+	loadSourceSchema()
+	tables, err := diagramTables(table, depth, pattern)
+	if nil != err {
+		return err
+	}
+
+	var content string
+	if DiagramFormatMermaid == format {
+		content = mermaidDiagram(tables)
+		if ".md" == strings.ToLower(filepath.Ext(output)) {
+			content = "```mermaid\n" + content + "```\n"
+		}
+	} else {
+		content = dotDiagram(tables)
+	}
+
+	if "" == output {
+		output = stdioPath
+	}
+	if err := writeOutput(output, []byte(content)); nil != err {
+		return err
+	}
+	fmt.Println("Generate", format, "diagram,", len(tables), "tables")
+	return nil
+}
+
+/**
+* Format by the output extension, .mmd and .md are mermaid, else dot
+ */
+func diagramFormatOf(output string) string {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".mmd", ".mermaid", ".md":
+		return DiagramFormatMermaid
+	}
+	return DiagramFormatDot
+}
+
+/**
+* Tables of the diagram sorted by name, filtered by the table neighborhood and the pattern
+ */
+func diagramTables(table string, depth int, pattern string) ([]*tableDef, error) {
+	included := make(map[string]bool)
+	for name := range gTableList {
+		included[name] = true
+	}
+
+	if "" != table {
+		if nil == gTableList[table] {
+			return nil, fmt.Errorf("table `%s` not found in the source schema", table)
+		}
+		included = tableNeighborhood(table, depth)
+	}
+
+	if "" != pattern {
+		globs := strings.Split(pattern, ",")
+		for _, glob := range globs {
+			if _, err := path.Match(strings.TrimSpace(glob), ""); nil != err {
+				return nil, fmt.Errorf("invalid table pattern [%s]: %s", glob, err.Error())
+			}
+		}
+		for name := range included {
+			matched := false
+			for _, glob := range globs {
+				if match, _ := path.Match(strings.TrimSpace(glob), name); match {
+					matched = true
+					break
+				}
+			}
+			if !matched && name != table {
+				delete(included, name)
+			}
+		}
+	}
+
+	var tables []*tableDef
+	for _, name := range sortedTableNames(gTableList) {
+		if included[name] {
+			tables = append(tables, tableDefFromSchema(name, gTableList[name]))
+		}
+	}
+	return tables, nil
+}
+
+/**
+* Tables within depth foreign keys of the table, in both directions, all the connected tables when depth < 0
+ */
+func tableNeighborhood(table string, depth int) map[string]bool {
+	// Undirected foreign key graph
+	edges := make(map[string][]string)
+	for name, mys := range gTableList {
+		for _, ref := range mys.RelationTables() {
+			if nil == gTableList[ref] || ref == name {
+				continue
+			}
+			edges[name] = append(edges[name], ref)
+			edges[ref] = append(edges[ref], name)
+		}
+	}
+
+	seen := map[string]bool{table: true}
+	current := []string{table}
+	for level := 0; (depth < 0 || level < depth) && len(current) > 0; level++ {
+		var next []string
+		for _, name := range current {
+			for _, ref := range edges[name] {
+				if !seen[ref] {
+					seen[ref] = true
+					next = append(next, ref)
+				}
+			}
+		}
+		current = next
+	}
+	return seen
+}
+
+/**
+* Key marks of the columns: PK, FK and UK
+ */
+func columnKeys(td *tableDef) map[string][]string {
+	keys := make(map[string][]string)
+	add := func(col, key string) {
+		if p := strings.Index(col, "("); p > 0 { // prefix length
+			col = col[:p]
+		}
+		if !inStringSlice(key, keys[col]) {
+			keys[col] = append(keys[col], key)
+		}
+	}
+	for _, idx := range td.Indexes {
+		if "PRIMARY" == idx.Kind {
+			for _, col := range idx.Columns {
+				add(col, "PK")
+			}
+		}
+	}
+	for _, fk := range td.Foreign {
+		for _, col := range fk.Columns {
+			add(col, "FK")
+		}
+	}
+	for _, idx := range td.Indexes {
+		if "UNIQUE" == idx.Kind && len(idx.Columns) == 1 {
+			add(idx.Columns[0], "UK")
+		}
+	}
+	return keys
+}
+
+/**
+* Foreign key of the diagram, the referenced table is in the diagram
+ */
+func diagramForeignKeys(td *tableDef, included map[string]bool) []*foreignKeyDef {
+	var fks []*foreignKeyDef
+	for _, fk := range td.Foreign {
+		if included[fk.RefTable] {
+			fks = append(fks, fk)
+		}
+	}
+	return fks
+}
+
+func includedTables(tables []*tableDef) map[string]bool {
+	included := make(map[string]bool)
+	for _, td := range tables {
+		included[td.Name] = true
+	}
+	return included
+}
+
+/**
+* Graphviz digraph, a table node per table and an edge per foreign key from the column to the referenced column
+ */
+func dotDiagram(tables []*tableDef) string {
+	var buf strings.Builder
+	buf.WriteString("digraph schema {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [shape=plaintext, fontname=\"Helvetica\", fontsize=10];\n")
+	buf.WriteString("  edge [fontname=\"Helvetica\", fontsize=9, arrowhead=tee, arrowtail=crow, dir=both];\n")
+
+	ports := make(map[string]map[string]int) // table -> column -> port
+	for _, td := range tables {
+		keys := columnKeys(td)
+		ports[td.Name] = make(map[string]int)
+
+		fmt.Fprintf(&buf, "\n  %s [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n", dotID(td.Name))
+		title := "<b>" + html.EscapeString(td.Name) + "</b>"
+		if "" != td.Comment {
+			title += "<br/><i>" + html.EscapeString(td.Comment) + "</i>"
+		}
+		fmt.Fprintf(&buf, "    <tr><td bgcolor=\"#dde4ee\" colspan=\"3\">%s</td></tr>\n", title)
+		for i, col := range td.Columns {
+			ports[td.Name][col.Name] = i
+			fmt.Fprintf(&buf, "    <tr><td align=\"left\" port=\"c%d\">%s</td><td align=\"left\">%s</td><td>%s</td></tr>\n",
+				i, html.EscapeString(col.Name), html.EscapeString(col.Type), strings.Join(keys[col.Name], ","))
+		}
+		buf.WriteString("  </table>>];\n")
+	}
+
+	included := includedTables(tables)
+	first := true
+	for _, td := range tables {
+		for _, fk := range diagramForeignKeys(td, included) {
+			if first {
+				buf.WriteString("\n")
+				first = false
+			}
+			from, to := dotID(td.Name), dotID(fk.RefTable)
+			if len(fk.Columns) > 0 {
+				if port, has := ports[td.Name][fk.Columns[0]]; has {
+					from += fmt.Sprintf(":c%d", port)
+				}
+			}
+			if len(fk.RefColumns) > 0 {
+				if port, has := ports[fk.RefTable][fk.RefColumns[0]]; has {
+					to += fmt.Sprintf(":c%d", port)
+				}
+			}
+			fmt.Fprintf(&buf, "  %s -> %s [label=%s];\n", from, to, dotID(fk.Name))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+/**
+* Quoted DOT identifier
+ */
+func dotID(name string) string {
+	return "\"" + strings.Replace(strings.Replace(name, "\\", "\\\\", -1), "\"", "\\\"", -1) + "\""
+}
+
+/**
+* Mermaid erDiagram, an entity per table and a relationship per foreign key
+ */
+func mermaidDiagram(tables []*tableDef) string {
+	var buf strings.Builder
+	buf.WriteString("erDiagram\n")
+
+	for _, td := range tables {
+		keys := columnKeys(td)
+		fmt.Fprintf(&buf, "    %s {\n", mermaidName(td.Name))
+		for _, col := range td.Columns {
+			line := mermaidType(col.Type) + " " + mermaidName(col.Name)
+			if len(keys[col.Name]) > 0 {
+				line += " " + strings.Join(keys[col.Name], ", ")
+			}
+			if "" != col.Comment {
+				line += " " + mermaidString(col.Comment)
+			}
+			fmt.Fprintf(&buf, "        %s\n", line)
+		}
+		buf.WriteString("    }\n")
+	}
+
+	included := includedTables(tables)
+	for _, td := range tables {
+		for _, fk := range diagramForeignKeys(td, included) {
+			fmt.Fprintf(&buf, "    %s %s %s : %s\n", mermaidName(td.Name), mermaidCardinality(td, fk), mermaidName(fk.RefTable), mermaidString(fk.Name))
+		}
+	}
+	return buf.String()
+}
+
+/**
+* Relationship of the referencing table to the referenced table:
+* one to one when the foreign key columns are unique, the referenced row is optional when a column is nullable
+ */
+func mermaidCardinality(td *tableDef, fk *foreignKeyDef) string {
+	many := "}o"
+	for _, idx := range td.Indexes {
+		if ("PRIMARY" == idx.Kind || "UNIQUE" == idx.Kind) && strings.Join(idx.Columns, ",") == strings.Join(fk.Columns, ",") {
+			many = "|o"
+			break
+		}
+	}
+
+	one := "||"
+	for _, col := range td.Columns {
+		if inStringSlice(col.Name, fk.Columns) && !col.NotNull {
+			one = "o|"
+			break
+		}
+	}
+	return many + "--" + one
+}
+
+/**
+* Mermaid names are letters, digits, - and _
+ */
+func mermaidName(name string) string {
+	return mermaidChars(name, "")
+}
+
+/**
+* Column type of mermaid, ex: decimal(10,2) unsigned -> decimal(10_2)_unsigned
+ */
+func mermaidType(colType string) string {
+	return mermaidChars(colType, "()")
+}
+
+/**
+* Replace the characters other than letters, digits, - , _ and the extra ones with _
+ */
+func mermaidChars(str, extra string) string {
+	var buf strings.Builder
+	for _, c := range str {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || '_' == c || '-' == c || strings.ContainsRune(extra, c) {
+			buf.WriteRune(c)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	return buf.String()
+}
+
+func mermaidString(str string) string {
+	str = strings.Replace(str, "\"", "'", -1)
+	str = strings.Replace(str, "\r", " ", -1)
+	return "\"" + strings.Replace(str, "\n", " ", -1) + "\""
+}
@@ -0,0 +1,310 @@
+// Data dictionary of the source schema, Markdown and static HTML
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	docsMarkdownFile = "schema.md"
+	docsHTMLFile     = "index.html"
+)
+
+// table of the data dictionary
+type docTable struct {
+	*tableDef
+	Key          map[string]string // column -> PRI / UNI / MUL
+	ReferencedBy []*docReference
+}
+
+// foreign key of another table to this table
+type docReference struct {
+	Table string
+	FK    *foreignKeyDef
+}
+
+/**
+* Write the data dictionary of the source schema to dir
+ */
+func GenerateDocs(dir string) error {
+	if "" == dir || stdioPath == dir {
+		return fmt.Errorf("docs output not set, use -o <dir>")
+	}
+
+	loadSourceSchema()
+	if err := writeDocs(dir); nil != err {
+		return err
+	}
+	fmt.Println("Generate docs to", dir, ",", len(gTableList), "tables")
+	return nil
+}
+
+/**
+* Render the loaded source schema to dir, schema.md and index.html
+ */
+func writeDocs(dir string) error {
+	tables := docTables()
+	if err := os.MkdirAll(dir, os.ModePerm); nil != err {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, docsMarkdownFile), []byte(docsMarkdown(tables, gObjectList)), 0644); nil != err {
+		return err
+	}
+	page, err := docsHTML(tables, gObjectList)
+	if nil != err {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, docsHTMLFile), page, 0644)
+}
+
+/**
+* Tables sorted by name, with the column keys and the references from other tables
+ */
+func docTables() []*docTable {
+	var tables []*docTable
+	byName := make(map[string]*docTable)
+	for _, name := range sortedTableNames(gTableList) {
+		td := tableDefFromSchema(name, gTableList[name])
+		table := &docTable{tableDef: td, Key: make(map[string]string)}
+
+		for _, idx := range td.Indexes {
+			if len(idx.Columns) == 0 {
+				continue
+			}
+			col := idx.Columns[0]
+			if p := strings.Index(col, "("); p > 0 {
+				col = col[:p]
+			}
+			switch {
+			case "PRIMARY" == idx.Kind:
+				table.Key[col] = "PRI"
+			case "UNIQUE" == idx.Kind && len(idx.Columns) == 1 && "" == table.Key[col]:
+				table.Key[col] = "UNI"
+			case "" == table.Key[col]:
+				table.Key[col] = "MUL"
+			}
+		}
+		tables = append(tables, table)
+		byName[name] = table
+	}
+
+	for _, table := range tables {
+		for _, fk := range table.Foreign {
+			if ref := byName[fk.RefTable]; nil != ref {
+				ref.ReferencedBy = append(ref.ReferencedBy, &docReference{Table: table.Name, FK: fk})
+			}
+		}
+	}
+	return tables
+}
+
+/**
+* Default of the column for display, NULL for the nullable columns without default
+ */
+func docDefault(col *columnDef) string {
+	if nil == col.Default {
+		if col.NotNull {
+			return ""
+		}
+		return "NULL"
+	}
+	if "" == *col.Default {
+		return "''"
+	}
+	return *col.Default
+}
+
+/**
+* Extra of the column, as DESC: auto_increment, on update
+ */
+func docExtra(col *columnDef) string {
+	var extra []string
+	if col.AutoIncrement {
+		extra = append(extra, "auto_increment")
+	}
+	if "" != col.OnUpdate {
+		extra = append(extra, "on update "+col.OnUpdate)
+	}
+	if "" != col.Collate {
+		extra = append(extra, "collate "+col.Collate)
+	} else if "" != col.Charset {
+		extra = append(extra, "charset "+col.Charset)
+	}
+	return strings.Join(extra, ", ")
+}
+
+func docForeignKey(fk *foreignKeyDef) string {
+	s := fmt.Sprintf("(%s) -> %s (%s)", strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+	if "" != fk.OnDelete {
+		s += " ON DELETE " + fk.OnDelete
+	}
+	if "" != fk.OnUpdate {
+		s += " ON UPDATE " + fk.OnUpdate
+	}
+	return s
+}
+
+func docYesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+/**
+* Text of a markdown table cell
+ */
+func mdCell(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	s = strings.Replace(s, "\r\n", "<br>", -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+/**
+* Markdown data dictionary, one section per table with the table of contents
+ */
+func docsMarkdown(tables []*docTable, objects []*DbObject) string {
+	var buf strings.Builder
+	buf.WriteString("# Data Dictionary\n\n")
+	fmt.Fprintf(&buf, "Generated by StructSync, %d tables.\n\n", len(tables)) // no timestamp, same schema same docs
+
+	buf.WriteString("| Table | Comment |\n| --- | --- |\n")
+	for _, table := range tables {
+		fmt.Fprintf(&buf, "| [%s](#table-%s) | %s |\n", mdCell(table.Name), table.Name, mdCell(table.Comment))
+	}
+
+	for _, table := range tables {
+		fmt.Fprintf(&buf, "\n<a id=\"table-%s\"></a>\n\n## %s\n\n", table.Name, table.Name)
+		if "" != table.Comment {
+			buf.WriteString(mdCell(table.Comment) + "\n\n")
+		}
+		if "" != table.Options {
+			fmt.Fprintf(&buf, "`%s`\n\n", table.Options)
+		}
+
+		buf.WriteString("| Column | Type | Nullable | Default | Key | Extra | Comment |\n| --- | --- | --- | --- | --- | --- | --- |\n")
+		for _, col := range table.Columns {
+			fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %s | %s |\n", mdCell(col.Name), mdCell(col.Type), docYesNo(!col.NotNull),
+				mdCell(docDefault(col)), table.Key[col.Name], mdCell(docExtra(col)), mdCell(col.Comment))
+		}
+
+		if len(table.Indexes) > 0 {
+			buf.WriteString("\n**Indexes**\n\n| Name | Type | Columns |\n| --- | --- | --- |\n")
+			for _, idx := range table.Indexes {
+				name := idx.Name
+				if "PRIMARY" == idx.Kind {
+					name = "PRIMARY"
+				}
+				fmt.Fprintf(&buf, "| %s | %s | %s |\n", mdCell(name), idx.Kind, mdCell(strings.Join(idx.Columns, ", ")))
+			}
+		}
+
+		if len(table.Foreign) > 0 {
+			buf.WriteString("\n**Foreign keys**\n\n| Name | Columns | References | On delete | On update |\n| --- | --- | --- | --- | --- |\n")
+			for _, fk := range table.Foreign {
+				fmt.Fprintf(&buf, "| %s | %s | [%s](#table-%s) (%s) | %s | %s |\n", mdCell(fk.Name), mdCell(strings.Join(fk.Columns, ", ")),
+					fk.RefTable, fk.RefTable, mdCell(strings.Join(fk.RefColumns, ", ")), fk.OnDelete, fk.OnUpdate)
+			}
+		}
+
+		if len(table.ReferencedBy) > 0 {
+			buf.WriteString("\n**Referenced by**\n\n")
+			for _, ref := range table.ReferencedBy {
+				fmt.Fprintf(&buf, "- [%s](#table-%s) `%s` %s\n", ref.Table, ref.Table, ref.FK.Name, mdCell(docForeignKey(ref.FK)))
+			}
+		}
+	}
+
+	if len(objects) > 0 {
+		buf.WriteString("\n## Views, routines and triggers\n\n| Type | Name |\n| --- | --- |\n")
+		for _, obj := range objects {
+			fmt.Fprintf(&buf, "| %s | %s |\n", obj.Type, mdCell(obj.Name))
+		}
+	}
+	return buf.String()
+}
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"default": docDefault,
+	"extra":   docExtra,
+	"fk":      docForeignKey,
+	"yesNo":   docYesNo,
+	"join":    strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Data Dictionary</title>
+<style>
+body { margin: 0; font: 14px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #24292f; }
+nav { position: fixed; top: 0; bottom: 0; left: 0; width: 240px; overflow-y: auto; padding: 12px; background: #f6f8fa; border-right: 1px solid #d0d7de; box-sizing: border-box; }
+nav input { width: 100%; margin-bottom: 8px; padding: 4px; box-sizing: border-box; }
+nav a { display: block; color: #0969da; text-decoration: none; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+main { margin-left: 240px; padding: 12px 24px; }
+table { border-collapse: collapse; margin: 8px 0 16px; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code { background: #f6f8fa; padding: 2px 4px; }
+h2 { border-bottom: 1px solid #d0d7de; padding-top: 12px; }
+.comment { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<nav>
+<input id="filter" placeholder="Filter tables" oninput="var f=this.value.toLowerCase();document.querySelectorAll('nav a').forEach(function(a){a.style.display=a.textContent.toLowerCase().indexOf(f)<0?'none':''})">
+{{range .Tables}}<a href="#table-{{.Name}}" title="{{.Comment}}">{{.Name}}</a>
+{{end}}</nav>
+<main>
+<h1>Data Dictionary</h1>
+<p>Generated by StructSync, {{len .Tables}} tables.</p>
+{{range .Tables}}{{$table := .}}
+<h2 id="table-{{.Name}}">{{.Name}}</h2>
+{{if .Comment}}<p class="comment">{{.Comment}}</p>{{end}}
+{{if .Options}}<p><code>{{.Options}}</code></p>{{end}}
+<table>
+<tr><th>Column</th><th>Type</th><th>Nullable</th><th>Default</th><th>Key</th><th>Extra</th><th>Comment</th></tr>
+{{range .Columns}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{yesNo (not .NotNull)}}</td><td>{{default .}}</td><td>{{index $table.Key .Name}}</td><td>{{extra .}}</td><td class="comment">{{.Comment}}</td></tr>
+{{end}}</table>
+{{if .Indexes}}<h4>Indexes</h4>
+<table>
+<tr><th>Name</th><th>Type</th><th>Columns</th></tr>
+{{range .Indexes}}<tr><td>{{if eq .Kind "PRIMARY"}}PRIMARY{{else}}{{.Name}}{{end}}</td><td>{{.Kind}}</td><td>{{join .Columns ", "}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Foreign}}<h4>Foreign keys</h4>
+<table>
+<tr><th>Name</th><th>Columns</th><th>References</th><th>On delete</th><th>On update</th></tr>
+{{range .Foreign}}<tr><td>{{.Name}}</td><td>{{join .Columns ", "}}</td><td><a href="#table-{{.RefTable}}">{{.RefTable}}</a> ({{join .RefColumns ", "}})</td><td>{{.OnDelete}}</td><td>{{.OnUpdate}}</td></tr>
+{{end}}</table>{{end}}
+{{if .ReferencedBy}}<h4>Referenced by</h4>
+<ul>
+{{range .ReferencedBy}}<li><a href="#table-{{.Table}}">{{.Table}}</a> <code>{{.FK.Name}}</code> {{fk .FK}}</li>
+{{end}}</ul>{{end}}
+{{end}}
+{{if .Objects}}<h2>Views, routines and triggers</h2>
+<table>
+<tr><th>Type</th><th>Name</th></tr>
+{{range .Objects}}<tr><td>{{.Type}}</td><td>{{.Name}}</td></tr>
+{{end}}</table>{{end}}
+</main>
+</body>
+</html>
+`))
+
+/**
+* Static HTML data dictionary, one page with the table list
+ */
+func docsHTML(tables []*docTable, objects []*DbObject) ([]byte, error) {
+	var buf bytes.Buffer
+	err := docsTemplate.Execute(&buf, map[string]interface{}{
+		"Tables":  tables,
+		"Objects": objects,
+	})
+	return buf.Bytes(), err
+}
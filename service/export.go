@@ -0,0 +1,159 @@
+// Schema snapshot export
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"struct_sync/common"
+	"struct_sync/logger"
+	db "struct_sync/model"
+)
+
+const objectTypeTable = "TABLE"
+
+/**
+* Export the source schema to one file, or to a directory with one file per table
+ */
+func ExportSchema(output string, split bool) error {
+	if "" == output {
+		return fmt.Errorf("export output not set, use -o <file or dir>")
+	}
+
+	loadSourceSchema()
+	objects := gObjectList
+	if globalSet.InputMode == DbMode && !globalSet.SyncObjects {
+		var err error
+		if objects, err = loadSrcDbObjects(globalSet.SrcDbDsn); nil != err {
+			return fmt.Errorf("query source objects failed: %s", err.Error())
+		}
+	}
+
+	if split {
+		if stdioPath == output {
+			return fmt.Errorf("can't export -split to stdout, use -o <dir>")
+		}
+		return exportSchemaDir(output, objects)
+	}
+	if isYamlSchemaFile(output) {
+		return exportYamlSchema(output, objects)
+	}
+	return exportSchemaFile(output, objects)
+}
+
+/**
+* Query views, routines and triggers of the source database
+ */
+func loadSrcDbObjects(dbSet *DBSet) ([]*DbObject, error) {
+	if dbSet.timeout == "" {
+		dbSet.timeout = globalSet.TimeOut
+	}
+
+	srcDb, err := db.NewMysqlDb(dbSet.dsn(dbSet.DbName))
+	if nil != err {
+		return nil, err
+	}
+	defer srcDb.Close()
+
+	return getDbObjects(srcDb)
+}
+
+/**
+* Create table sql for export, without AUTO_INCREMENT
+ */
+func exportTableSQL(table string) string {
+	return common.RemoveAutoIncrement(gTableList[table].SchemaRaw) + ";\n"
+}
+
+/**
+* Export all to one file
+ */
+func exportSchemaFile(fileName string, objects []*DbObject) error {
+	var buf strings.Builder
+	buf.WriteString("-- StructSync schema export\n")
+	for _, table := range sortedTableNames(gTableList) {
+		buf.WriteString(fmt.Sprintf("\n-- TABLE `%s`\n", table))
+		buf.WriteString(exportTableSQL(table))
+	}
+	for _, obj := range objects {
+		buf.WriteString(fmt.Sprintf("\n-- %s\n", obj))
+		buf.WriteString(obj.delimitedSQL())
+	}
+
+	if err := writeOutput(fileName, []byte(buf.String())); nil != err {
+		return err
+	}
+
+	fmt.Println("Export schema to", fileName, ",", len(gTableList), "tables,", len(objects), "objects")
+	return nil
+}
+
+/**
+* Export tables to one yaml or json file, the declarative format has no objects
+ */
+func exportYamlSchema(fileName string, objects []*DbObject) error {
+	data, err := marshalYamlSchema(fileName, gTableList)
+	if nil != err {
+		return err
+	}
+	if len(objects) > 0 {
+		logger.Warn("Declarative schema has tables only,", len(objects), "objects not exported")
+	}
+
+	if err := writeOutput(fileName, data); nil != err {
+		return err
+	}
+
+	fmt.Println("Export schema to", fileName, ",", len(gTableList), "tables")
+	return nil
+}
+
+/**
+* Export to directory, one file per table, view, routine and trigger
+ */
+func exportSchemaDir(dir string, objects []*DbObject) error {
+	// Clean the files of the last export, the dropped tables are removed
+	for _, sub := range schemaLayout() {
+		subDir := filepath.Join(dir, sub)
+		if err := os.MkdirAll(subDir, os.ModePerm); nil != err {
+			return err
+		}
+		oldFiles, _ := filepath.Glob(filepath.Join(subDir, "*.sql"))
+		for _, file := range oldFiles {
+			if err := os.Remove(file); nil != err {
+				return err
+			}
+		}
+	}
+
+	for _, table := range sortedTableNames(gTableList) {
+		if err := writeExportFile(dir, objectTypeTable, table, exportTableSQL(table)); nil != err {
+			return err
+		}
+	}
+	for _, obj := range objects {
+		if err := writeExportFile(dir, obj.Type, obj.Name, obj.delimitedSQL()); nil != err {
+			return err
+		}
+	}
+
+	fmt.Println("Export schema to", dir, ",", len(gTableList), "tables,", len(objects), "objects")
+	return nil
+}
+
+func writeExportFile(dir, objType, name, sql string) error {
+	return ioutil.WriteFile(objectFileName(dir, objType, name), []byte(sql), 0644)
+}
+
+/**
+* Table names in order
+ */
+func sortedTableNames(tables map[string]*MySchema) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	return sortStrings(names)
+}
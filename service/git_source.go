@@ -0,0 +1,123 @@
+// Git revision schema source
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+/**
+* Run git in the schema repository
+ */
+func gitOutput(args ...string) (string, error) {
+	repo := globalSet.GitRepo
+	if "" == repo {
+		repo = "."
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if nil != err {
+		msg := strings.TrimSpace(stderr.String())
+		if "" == msg {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+	return string(out), nil
+}
+
+/**
+* Read the schema files at the ref, the path is a schema file or a schema directory.
+* The content is the blob as committed, without the textconv and filters of git show
+ */
+func readGitSchema(ref, schemaPath string) ([]schemaFile, error) {
+	if "" == ref || strings.HasPrefix(ref, "-") { // not an option of git
+		return nil, fmt.Errorf("invalid git ref [%s]", ref)
+	}
+	schemaPath = strings.Trim(strings.ReplaceAll(schemaPath, "\\", "/"), "/")
+	objType, err := gitOutput("cat-file", "-t", ref+":"+schemaPath)
+	if nil != err {
+		return nil, err
+	}
+
+	// A single schema file
+	if "blob" == strings.TrimSpace(objType) {
+		content, err := gitOutput("cat-file", "blob", ref+":"+schemaPath)
+		if nil != err {
+			return nil, err
+		}
+		return []schemaFile{{Path: ref + ":" + schemaPath, Content: content}}, nil
+	}
+
+	glob, err := schemaFileGlob()
+	if nil != err {
+		return nil, err
+	}
+
+	args := []string{"ls-tree", "-r", "-z", "--name-only", "--full-tree", ref}
+	if "" != schemaPath {
+		args = append(args, "--", schemaPath)
+	}
+	list, err := gitOutput(args...)
+	if nil != err {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range strings.Split(list, "\x00") {
+		rel := strings.TrimPrefix(name, schemaPath+"/")
+		if "" == schemaPath {
+			rel = name
+		}
+		if "" == name || !inSchemaLayout(rel) {
+			continue
+		}
+		if match, _ := path.Match(glob, path.Base(name)); match {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no schema file [%s] found in %s:%s", glob, ref, schemaPath)
+	}
+	sort.Strings(names)
+
+	files := make([]schemaFile, 0, len(names))
+	for _, name := range names {
+		content, err := gitOutput("cat-file", "blob", ref+":"+name)
+		if nil != err {
+			return nil, err
+		}
+		files = append(files, schemaFile{Path: ref + ":" + name, Content: content})
+	}
+	return files, nil
+}
+
+/**
+* The file is in one of the layout sub directories
+ */
+func inSchemaLayout(rel string) bool {
+	for _, sub := range schemaLayout() {
+		if strings.HasPrefix(rel, strings.Trim(sub, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* Parser the schema at the ref
+ */
+func loadGitSchema(ref string) (*schemaSource, error) {
+	files, err := readGitSchema(ref, globalSet.GitPath)
+	if nil != err {
+		return nil, err
+	}
+	return loadSchemaFiles(files)
+}
@@ -0,0 +1,495 @@
+// Go struct schema source
+package service
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// column type of go type
+var goTypeColumns = map[string]string{
+	"bool":            "tinyint(1)",
+	"int":             "bigint",
+	"int8":            "tinyint",
+	"int16":           "smallint",
+	"int32":           "int",
+	"int64":           "bigint",
+	"uint":            "bigint unsigned",
+	"uint8":           "tinyint unsigned",
+	"uint16":          "smallint unsigned",
+	"uint32":          "int unsigned",
+	"uint64":          "bigint unsigned",
+	"float32":         "float",
+	"float64":         "double",
+	"string":          "varchar",
+	"[]byte":          "blob",
+	"time.Time":       "datetime(3)",
+	"sql.NullBool":    "tinyint(1)",
+	"sql.NullInt16":   "smallint",
+	"sql.NullInt32":   "int",
+	"sql.NullInt64":   "bigint",
+	"sql.NullFloat64": "double",
+	"sql.NullString":  "varchar",
+	"sql.NullTime":    "datetime(3)",
+	"gorm.DeletedAt":  "datetime(3)",
+}
+
+// varchar size of a string key or a string with default, when no size, as gorm does
+const keyStringSize = 191
+
+// go struct of a table
+type goStruct struct {
+	Name   string
+	File   string
+	Fields []*ast.Field
+	IsGorm bool // has gorm tag, or embeds gorm.Model
+	Table  string
+}
+
+/**
+* Parser the go package of the dir, the structs with gorm / db tags are tables
+ */
+func loadGoSchema(dir string) (*schemaSource, error) {
+	fset := token.NewFileSet()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if nil != err {
+		return nil, err
+	}
+
+	structs := make(map[string]*goStruct)
+	tableNames := make(map[string]string) // struct -> TableName()
+	var names []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if nil != err {
+			return nil, err
+		}
+
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					typeSpec, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					if st, ok := typeSpec.Type.(*ast.StructType); ok {
+						structs[typeSpec.Name.Name] = &goStruct{Name: typeSpec.Name.Name, File: path, Fields: st.Fields.List}
+						names = append(names, typeSpec.Name.Name)
+					}
+				}
+			case *ast.FuncDecl:
+				if recv, table := tableNameMethod(d); "" != recv {
+					tableNames[recv] = table
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var files []schemaFile
+	for _, name := range names {
+		gs := structs[name]
+		if !isTableStruct(gs) {
+			continue
+		}
+
+		gs.IsGorm = hasGormTag(gs.Fields)
+		gs.Table = tableNames[name]
+		if "" == gs.Table {
+			gs.Table = snakeCase(name)
+			if gs.IsGorm { // gorm default naming
+				gs.Table = pluralName(gs.Table)
+			}
+		}
+
+		td, err := goStructTable(gs, structs)
+		if nil != err {
+			return nil, fmt.Errorf("%s: struct %s: %s", gs.File, name, err.Error())
+		}
+		files = append(files, schemaFile{Path: gs.File + ":" + name, Content: td.createSQL() + ";\n"})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no struct with gorm or db tag found in %s", dir)
+	}
+
+	return loadSchemaFiles(files)
+}
+
+/**
+* Receiver and the returned string of func (T) TableName() string { return "name" }
+ */
+func tableNameMethod(fn *ast.FuncDecl) (string, string) {
+	if "TableName" != fn.Name.Name || nil == fn.Recv || len(fn.Recv.List) != 1 || nil == fn.Body || len(fn.Body.List) != 1 {
+		return "", ""
+	}
+
+	recvType := fn.Recv.List[0].Type
+	if star, ok := recvType.(*ast.StarExpr); ok {
+		recvType = star.X
+	}
+	recv, ok := recvType.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+
+	ret, ok := fn.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", ""
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", ""
+	}
+	table, err := strconv.Unquote(lit.Value)
+	if nil != err {
+		return "", ""
+	}
+	return recv.Name, table
+}
+
+/**
+* Struct has gorm / db tag, or embeds gorm.Model
+ */
+func isTableStruct(gs *goStruct) bool {
+	for _, field := range gs.Fields {
+		if "gorm.Model" == typeString(field.Type) && len(field.Names) == 0 {
+			return true
+		}
+		tag := fieldTag(field)
+		if _, has := tag.Lookup("gorm"); has {
+			return true
+		}
+		if _, has := tag.Lookup("db"); has {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGormTag(fields []*ast.Field) bool {
+	for _, field := range fields {
+		if _, has := fieldTag(field).Lookup("gorm"); has || "gorm.Model" == typeString(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* Map the struct fields to table columns and indexes
+ */
+func goStructTable(gs *goStruct, structs map[string]*goStruct) (*tableDef, error) {
+	td := &tableDef{Name: gs.Table}
+	if err := addGoFields(td, gs.Fields, "", gs.IsGorm, structs, 0); nil != err {
+		return nil, err
+	}
+	if len(td.Columns) == 0 {
+		return nil, fmt.Errorf("no column")
+	}
+
+	// primary key, default the id field
+	var primary *indexDef
+	for _, idx := range td.Indexes {
+		if "PRIMARY" == idx.Kind {
+			primary = idx
+		}
+	}
+	if nil != primary && len(primary.Columns) > 1 { // composite primary key, no auto increment as gorm does
+		for _, name := range primary.Columns {
+			td.column(name).AutoIncrement = false
+		}
+	}
+	if nil == primary && nil != td.column("id") {
+		primary = &indexDef{Kind: "PRIMARY", Columns: []string{"id"}}
+		td.Indexes = append([]*indexDef{primary}, td.Indexes...)
+		td.column("id").NotNull = true
+		if col := td.column("id"); isIntegerType(col.Type) && !col.AutoIncrement && nil == col.Default {
+			col.AutoIncrement = true
+		}
+	}
+	return td, nil
+}
+
+/**
+* Add the fields of the struct, embedded structs are expanded. isGorm: columns as gorm AutoMigrate creates them
+ */
+func addGoFields(td *tableDef, fields []*ast.Field, prefix string, isGorm bool, structs map[string]*goStruct, depth int) error {
+	if depth > 8 {
+		return fmt.Errorf("embedded struct too deep")
+	}
+
+	for _, field := range fields {
+		tag := fieldTag(field)
+		settings := gormSettings(tag.Get("gorm"))
+		goType := typeString(field.Type)
+		if _, ignore := settings["-"]; ignore || "-" == tag.Get("db") {
+			continue
+		}
+
+		// gorm.Model
+		if "gorm.Model" == goType {
+			addGormModel(td, prefix)
+			continue
+		}
+
+		// embedded struct, or gorm:"embedded"
+		_, embedded := settings["embedded"]
+		if len(field.Names) == 0 || embedded {
+			name := strings.TrimPrefix(goType, "*")
+			if sub, has := structs[name]; has {
+				if err := addGoFields(td, sub.Fields, prefix+settings["embeddedprefix"], isGorm, structs, depth+1); nil != err {
+					return err
+				}
+				continue
+			}
+			if len(field.Names) == 0 {
+				continue // embedded struct of other package
+			}
+		}
+
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			if err := addGoColumn(td, ident.Name, goType, prefix, isGorm, tag, settings, structs); nil != err {
+				return fmt.Errorf("field %s: %s", ident.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+/**
+* Add the column of one field
+ */
+func addGoColumn(td *tableDef, fieldName, goType, prefix string, isGorm bool, tag reflect.StructTag, settings map[string]string,
+	structs map[string]*goStruct) error {
+	col := &columnDef{Name: settings["column"]}
+	if "" == col.Name {
+		col.Name = strings.Split(tag.Get("db"), ",")[0]
+	}
+	if "" == col.Name {
+		col.Name = snakeCase(fieldName)
+	}
+	col.Name = prefix + col.Name
+
+	// column type
+	baseType := strings.TrimPrefix(goType, "*")
+	nullable := strings.HasPrefix(goType, "*") || strings.HasPrefix(baseType, "sql.Null") || "gorm.DeletedAt" == baseType
+	col.Type = settings["type"]
+	if "" == col.Type {
+		colType, has := goTypeColumns[baseType]
+		if !has {
+			if _, isStruct := structs[baseType]; isStruct || strings.HasPrefix(baseType, "[]") || strings.HasPrefix(baseType, "map[") {
+				return nil // association
+			}
+			return fmt.Errorf("unknown column type of %s, set gorm:\"type:...\"", goType)
+		}
+
+		col.Type = colType
+		if "varchar" == colType {
+			col.Type = goStringType(settings)
+		}
+	}
+
+	// nullability: tag first, gorm creates NULL columns except the primary key, the db tag structs by the go type
+	col.NotNull = !isGorm && !nullable
+	if _, has := settings["not null"]; has {
+		col.NotNull = true
+	}
+	if _, has := settings["null"]; has {
+		col.NotNull = false
+	}
+	if value, has := settings["default"]; has {
+		col.Default = &value
+	}
+	col.Comment = settings["comment"]
+	if _, has := settings["autoincrement"]; has {
+		col.AutoIncrement = "false" != settings["autoincrement"]
+	}
+
+	if td.column(col.Name) != nil {
+		return fmt.Errorf("duplicate column `%s`", col.Name)
+	}
+	td.Columns = append(td.Columns, col)
+
+	// indexes
+	_, primary := settings["primarykey"]
+	if _, has := settings["primary_key"]; has || primary {
+		col.NotNull = true
+		td.addIndexColumn("PRIMARY", "PRIMARY", col.Name)
+		if isIntegerType(col.Type) && "false" != settings["autoincrement"] && nil == col.Default { // as gorm does
+			col.AutoIncrement = true
+		}
+	}
+	for _, key := range []string{"index", "uniqueindex", "unique_index"} {
+		kind := "KEY"
+		if "index" != key {
+			kind = "UNIQUE"
+		}
+		if value, has := settings[key]; has {
+			name, options := gormIndexOptions(value)
+			if "" == name {
+				name = fmt.Sprintf("idx_%s_%s", td.Name, col.Name)
+			}
+			if _, unique := options["unique"]; unique {
+				kind = "UNIQUE"
+			}
+			if class := strings.ToUpper(options["class"]); inStringSlice(class, []string{"UNIQUE", "FULLTEXT", "SPATIAL"}) {
+				kind = class
+			}
+
+			column := col.Name
+			if length := options["length"]; "" != length {
+				column += "(" + length + ")"
+			}
+			if "DESC" == strings.ToUpper(options["sort"]) {
+				column += " DESC"
+			}
+			td.addIndexColumn(name, kind, column)
+		}
+	}
+	if _, has := settings["unique"]; has {
+		td.addIndexColumn(col.Name, "UNIQUE", col.Name)
+	}
+	return nil
+}
+
+/**
+* Column type of a string field as gorm mysql does: varchar(size), mediumtext or longtext by the size tag.
+* Without size: GoStringSize when set, else varchar(191) for a key or with default, longtext for the others
+ */
+func goStringType(settings map[string]string) string {
+	size, _ := strconv.Atoi(settings["size"])
+	if size <= 0 {
+		size = 0
+		if globalSet.GoStringSize > 0 {
+			size = globalSet.GoStringSize
+		} else {
+			for _, key := range []string{"primarykey", "primary_key", "index", "uniqueindex", "unique_index", "unique", "default"} {
+				if _, has := settings[key]; has {
+					size = keyStringSize
+					break
+				}
+			}
+		}
+	}
+
+	switch {
+	case size >= 65536 && size <= 1<<24:
+		return "mediumtext"
+	case size > 1<<24 || size == 0:
+		return "longtext"
+	}
+	return fmt.Sprintf("varchar(%d)", size)
+}
+
+/**
+* Name and options of a gorm index setting, ex: idx_name,unique,class:FULLTEXT,sort:desc,length:10; keys are lower case
+ */
+func gormIndexOptions(value string) (string, map[string]string) {
+	items := strings.Split(value, ",")
+	options := make(map[string]string)
+	for _, item := range items[1:] {
+		kv := strings.SplitN(item, ":", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			options[key] = strings.TrimSpace(kv[1])
+		} else {
+			options[key] = ""
+		}
+	}
+	return strings.TrimSpace(items[0]), options
+}
+
+/**
+* Columns of gorm.Model
+ */
+func addGormModel(td *tableDef, prefix string) {
+	td.Columns = append(td.Columns,
+		&columnDef{Name: prefix + "id", Type: "bigint unsigned", NotNull: true, AutoIncrement: true},
+		&columnDef{Name: prefix + "created_at", Type: "datetime(3)"},
+		&columnDef{Name: prefix + "updated_at", Type: "datetime(3)"},
+		&columnDef{Name: prefix + "deleted_at", Type: "datetime(3)"},
+	)
+	td.addIndexColumn("PRIMARY", "PRIMARY", prefix+"id")
+	td.addIndexColumn(fmt.Sprintf("idx_%s_%sdeleted_at", td.Name, prefix), "KEY", prefix+"deleted_at")
+}
+
+/**
+* Parser gorm tag, key is lower case, ex: column:name;type:varchar(64);not null. \; is a ; of the value as gorm does
+ */
+func gormSettings(tag string) map[string]string {
+	settings := make(map[string]string)
+	items := strings.Split(tag, ";")
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		for strings.HasSuffix(item, "\\") && i+1 < len(items) {
+			i++
+			item = item[:len(item)-1] + ";" + items[i]
+		}
+		item = strings.TrimSpace(item)
+		if "" == item {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			settings[key] = strings.TrimSpace(kv[1])
+		} else {
+			settings[key] = ""
+		}
+	}
+	return settings
+}
+
+func fieldTag(field *ast.Field) reflect.StructTag {
+	if nil == field.Tag {
+		return ""
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if nil != err {
+		return ""
+	}
+	return reflect.StructTag(tag)
+}
+
+/**
+* Type expression as written, ex: *time.Time, []byte
+ */
+func typeString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return "*" + typeString(t.X)
+	case *ast.SelectorExpr:
+		return typeString(t.X) + "." + t.Sel.Name
+	case *ast.ArrayType:
+		return "[]" + typeString(t.Elt)
+	case *ast.MapType:
+		return "map[" + typeString(t.Key) + "]" + typeString(t.Value)
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+func isIntegerType(colType string) bool {
+	colType = strings.ToLower(colType)
+	for _, intType := range []string{"tinyint", "smallint", "mediumint", "int", "bigint"} {
+		if strings.HasPrefix(colType, intType) {
+			return true
+		}
+	}
+	return false
+}
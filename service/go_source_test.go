@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestLoadGoSchema(t *testing.T) {
+	globalSet = &GlobalSet{}
+	source, err := loadGoSchema("testdata/gomodels")
+	if nil != err {
+		t.Fatalf("loadGoSchema() error: %v", err)
+	}
+
+	// gorm: NULL columns except the primary key and not null, index options
+	want := "CREATE TABLE `users` (\n" +
+		"  `id` bigint unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(64) NOT NULL,\n" +
+		"  `age` bigint DEFAULT NULL,\n" +
+		"  `bio` text,\n" +
+		"  `code` varchar(32) DEFAULT NULL,\n" +
+		"  `nick` longtext,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `idx_name_age` (`name`,`age` DESC),\n" +
+		"  FULLTEXT KEY `idx_users_bio` (`bio`),\n" +
+		"  KEY `idx_code` (`code`(10))\n" +
+		")"
+	if got := source.Tables["users"].SchemaRaw; got != want {
+		t.Errorf("users = %q, want %q", got, want)
+	}
+
+	// db tag: nullable by the go type
+	want = "CREATE TABLE `account` (\n" +
+		"  `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` longtext NOT NULL,\n" +
+		"  `note` longtext,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		")"
+	if got := source.Tables["account"].SchemaRaw; got != want {
+		t.Errorf("account = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+// JUnit XML report of the sync, for the drift checks of CI
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"struct_sync/logger"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+// one dest db
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Timestamp string           `xml:"timestamp,attr,omitempty"`
+	Cases     []*junitTestCase `xml:"testcase"`
+}
+
+// one table or object
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+/**
+* Write the JUnit report of the sync results to JUnitReport, when set
+ */
+func writeJUnitReport(rets []SyncRet) {
+	if "" == globalSet.JUnitReport {
+		return
+	}
+	data, err := junitReport(rets)
+	if nil == err {
+		err = writeOutput(globalSet.JUnitReport, []byte(logger.Redact(string(data))))
+	}
+	if nil != err {
+		logger.Warn("Write junit report failed: ", globalSet.JUnitReport, ",", err.Error())
+		fmt.Println("Write junit report failed:", err)
+		return
+	}
+	fmt.Println("Write junit report", globalSet.JUnitReport)
+}
+
+/**
+* JUnit XML of the sync results: a testsuite per dest db, a testcase per table and object.
+* A table fails with the diff and the sql when it differs from the source and was not adjusted
+ */
+func junitReport(rets []SyncRet) ([]byte, error) {
+	report := &junitTestSuites{Name: "StructSync"}
+	timestamp := time.Now().Format("2006-01-02T15:04:05")
+	for _, ret := range rets {
+		suite := &junitTestSuite{Name: ret.DbName, Timestamp: timestamp}
+
+		// The dest db failed or was skipped before the tables
+		if (syncRetFailed == ret.Ret || syncRetSkipped == ret.Ret) && "" != ret.Msg {
+			tc := &junitTestCase{Name: "sync", ClassName: ret.DbName}
+			tc.Error = &junitProblem{Message: ret.Msg, Type: "sync"}
+			if syncRetSkipped == ret.Ret {
+				tc.Error.Type = "skipped"
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+
+		for _, tr := range ret.Tables {
+			suite.Cases = append(suite.Cases, junitTableCase(ret.DbName, tr))
+		}
+
+		for _, tc := range suite.Cases {
+			suite.Tests++
+			if nil != tc.Failure {
+				suite.Failures++
+			} else if nil != tc.Error {
+				suite.Errors++
+			}
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Suites = append(report.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if nil != err {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+/**
+* Testcase of a table: passed when same or adjusted, error when the sql failed, failure when still differs
+ */
+func junitTableCase(dbName string, tr *TableRet) *junitTestCase {
+	tc := &junitTestCase{Name: tr.Name, ClassName: dbName}
+	if alterTypeNo == tr.Type {
+		return tc
+	}
+
+	detail := strings.TrimRight(tr.Diff, "\n")
+	if "" != detail {
+		detail += "\n\n"
+	}
+	detail += strings.TrimRight(tr.SQL, "\n")
+
+	switch {
+	case "" != tr.Err:
+		tc.Error = &junitProblem{Message: tr.Err, Type: "execute", Text: detail}
+	case "" != tr.Drift:
+		tc.Failure = &junitProblem{Message: "applied but still drifting: " + tr.Drift, Type: "drift", Text: detail}
+	case tr.Applied:
+		tc.SystemOut = &junitOutput{Text: tr.SQL}
+	default:
+		tc.Failure = &junitProblem{Message: fmt.Sprintf("differs from the source, needs %s", tr.Type), Type: "drift", Text: detail}
+	}
+	return tc
+}
@@ -0,0 +1,215 @@
+// Liquibase changelog output
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// author of the changeSets when ChangelogAuthor is not set
+const defaultChangelogAuthor = "StructSync"
+
+// liquibase changeSet of one table or object change
+type changeSet struct {
+	ID           string
+	Author       string
+	OnFail       string // HALT or MARK_RAN
+	Precondition *precondition
+	Comment      string
+	SQL          []string // one statement each
+	Rollback     []string
+}
+
+// tableExists, viewExists or sqlCheck precondition
+type precondition struct {
+	Not      bool
+	Kind     string
+	Name     string // table or view name
+	SQL      string // query of sqlCheck
+	Expected string // result of sqlCheck
+}
+
+/**
+* ChangeSets of the changes, the ids are unique by the migration version
+ */
+func changeSets(version string, plan []*TableAlterData, objAlters []*ObjectAlterData) []*changeSet {
+	author := globalSet.ChangelogAuthor
+	if "" == author {
+		author = defaultChangelogAuthor
+	}
+
+	var sets []*changeSet
+	for _, alter := range plan {
+		cs := &changeSet{
+			ID:           fmt.Sprintf("%s-%d-%s-%s", version, len(sets)+1, alter.Type, alter.Table),
+			Author:       author,
+			Precondition: &precondition{Kind: "tableExists", Name: alter.Table},
+			Comment:      fmt.Sprintf("%s TABLE `%s`", alter.Type, alter.Table),
+			SQL:          []string{strings.TrimRight(strings.TrimSpace(alter.SQL), ";")},
+		}
+		cs.setOnFail(alter.Type)
+		if sql := reverseAlterSQL(alter); "" != sql {
+			cs.Rollback = []string{sql}
+		}
+		sets = append(sets, cs)
+	}
+
+	for _, oa := range objAlters {
+		obj := oa.Object
+		cs := &changeSet{
+			ID:           fmt.Sprintf("%s-%d-%s-%s-%s", version, len(sets)+1, oa.Type, strings.ToLower(obj.Type), obj.Name),
+			Author:       author,
+			Precondition: objectPrecondition(obj),
+			Comment:      fmt.Sprintf("%s %s", oa.Type, obj),
+			SQL:          oa.SQL,
+			Rollback:     oa.reverse().SQL,
+		}
+		cs.setOnFail(oa.Type)
+		sets = append(sets, cs)
+	}
+	return sets
+}
+
+/**
+* Create runs when the table or object not exists, drop and alter when it exists.
+* create and drop are marked ran when already done, alter halts
+ */
+func (cs *changeSet) setOnFail(alterType AlterType) {
+	cs.OnFail = "MARK_RAN"
+	switch alterType {
+	case alterTypeCreate:
+		cs.Precondition.Not = true
+	case alterTypeAlter:
+		cs.OnFail = "HALT"
+	}
+}
+
+/**
+* Exists precondition of the view, routine or trigger
+ */
+func objectPrecondition(obj *DbObject) *precondition {
+	name := strings.Replace(obj.Name, "'", "''", -1)
+	switch obj.Type {
+	case objectTypeView:
+		return &precondition{Kind: "viewExists", Name: obj.Name}
+	case objectTypeTrigger:
+		return &precondition{Kind: "sqlCheck", Expected: "1", SQL: fmt.Sprintf("SELECT COUNT(*) FROM information_schema.TRIGGERS "+
+			"WHERE TRIGGER_SCHEMA = DATABASE() AND TRIGGER_NAME = '%s'", name)}
+	default:
+		return &precondition{Kind: "sqlCheck", Expected: "1", SQL: fmt.Sprintf("SELECT COUNT(*) FROM information_schema.ROUTINES "+
+			"WHERE ROUTINE_SCHEMA = DATABASE() AND ROUTINE_TYPE = '%s' AND ROUTINE_NAME = '%s'", obj.Type, name)}
+	}
+}
+
+/**
+* Liquibase XML changelog
+ */
+func liquibaseXML(sets []*changeSet) string {
+	var buf strings.Builder
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<databaseChangeLog
+    xmlns="http://www.liquibase.org/xml/ns/dbchangelog"
+    xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+    xsi:schemaLocation="http://www.liquibase.org/xml/ns/dbchangelog http://www.liquibase.org/xml/ns/dbchangelog/dbchangelog-latest.xsd">
+`)
+	for _, cs := range sets {
+		fmt.Fprintf(&buf, "    <changeSet id=\"%s\" author=\"%s\">\n", xmlEscape(cs.ID), xmlEscape(cs.Author))
+
+		fmt.Fprintf(&buf, "        <preConditions onFail=\"%s\">\n", cs.OnFail)
+		indent := "            "
+		if cs.Precondition.Not {
+			buf.WriteString(indent + "<not>\n")
+			indent += "    "
+		}
+		p := cs.Precondition
+		switch p.Kind {
+		case "tableExists":
+			fmt.Fprintf(&buf, "%s<tableExists tableName=\"%s\"/>\n", indent, xmlEscape(p.Name))
+		case "viewExists":
+			fmt.Fprintf(&buf, "%s<viewExists viewName=\"%s\"/>\n", indent, xmlEscape(p.Name))
+		default:
+			fmt.Fprintf(&buf, "%s<sqlCheck expectedResult=\"%s\">%s</sqlCheck>\n", indent, p.Expected, xmlEscape(p.SQL))
+		}
+		if cs.Precondition.Not {
+			buf.WriteString("            </not>\n")
+		}
+		buf.WriteString("        </preConditions>\n")
+
+		fmt.Fprintf(&buf, "        <comment>%s</comment>\n", xmlEscape(cs.Comment))
+		for _, sql := range cs.SQL {
+			fmt.Fprintf(&buf, "        <sql splitStatements=\"false\">%s</sql>\n", xmlCDATA(sql))
+		}
+		if len(cs.Rollback) > 0 {
+			buf.WriteString("        <rollback>\n")
+			for _, sql := range cs.Rollback {
+				fmt.Fprintf(&buf, "            <sql splitStatements=\"false\">%s</sql>\n", xmlCDATA(sql))
+			}
+			buf.WriteString("        </rollback>\n")
+		}
+		buf.WriteString("    </changeSet>\n")
+	}
+	buf.WriteString("</databaseChangeLog>\n")
+	return buf.String()
+}
+
+func xmlEscape(str string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(str))
+	return buf.String()
+}
+
+func xmlCDATA(str string) string {
+	return "<![CDATA[" + strings.Replace(str, "]]>", "]]]]><![CDATA[>", -1) + "]]>"
+}
+
+/**
+* Liquibase YAML changelog
+ */
+func liquibaseYAML(sets []*changeSet) (string, error) {
+	sqlChanges := func(stmts []string) []yaml.MapSlice {
+		var changes []yaml.MapSlice
+		for _, sql := range stmts {
+			changes = append(changes, yaml.MapSlice{{Key: "sql", Value: yaml.MapSlice{
+				{Key: "splitStatements", Value: false},
+				{Key: "sql", Value: sql},
+			}}})
+		}
+		return changes
+	}
+
+	var changeLog []yaml.MapSlice
+	for _, cs := range sets {
+		p := cs.Precondition
+		var check yaml.MapSlice
+		switch p.Kind {
+		case "tableExists":
+			check = yaml.MapSlice{{Key: "tableExists", Value: yaml.MapSlice{{Key: "tableName", Value: p.Name}}}}
+		case "viewExists":
+			check = yaml.MapSlice{{Key: "viewExists", Value: yaml.MapSlice{{Key: "viewName", Value: p.Name}}}}
+		default:
+			check = yaml.MapSlice{{Key: "sqlCheck", Value: yaml.MapSlice{{Key: "expectedResult", Value: p.Expected}, {Key: "sql", Value: p.SQL}}}}
+		}
+		if p.Not {
+			check = yaml.MapSlice{{Key: "not", Value: []yaml.MapSlice{check}}}
+		}
+
+		set := yaml.MapSlice{
+			{Key: "id", Value: cs.ID},
+			{Key: "author", Value: cs.Author},
+			{Key: "preConditions", Value: []yaml.MapSlice{{{Key: "onFail", Value: cs.OnFail}}, check}},
+			{Key: "comment", Value: cs.Comment},
+			{Key: "changes", Value: sqlChanges(cs.SQL)},
+		}
+		if len(cs.Rollback) > 0 {
+			set = append(set, yaml.MapItem{Key: "rollback", Value: sqlChanges(cs.Rollback)})
+		}
+		changeLog = append(changeLog, yaml.MapSlice{{Key: "changeSet", Value: set}})
+	}
+
+	data, err := yaml.Marshal(yaml.MapSlice{{Key: "databaseChangeLog", Value: changeLog}})
+	return string(data), err
+}
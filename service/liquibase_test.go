@@ -0,0 +1,34 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChangeSetsForeignKeyCycle(t *testing.T) {
+	globalSet = &GlobalSet{}
+
+	sets := changeSets("000001", cyclePlan(alterTypeCreate), nil)
+	var got []string
+	for _, cs := range sets {
+		got = append(got, cs.ID+": "+strings.Join(cs.Rollback, ";"))
+	}
+	want := []string{
+		"000001-1-create-a: DROP TABLE `a`",
+		"000001-2-create-b: DROP TABLE `b`",
+		"000001-3-alter-a: ALTER TABLE `a` DROP FOREIGN KEY `fk_a_b`",
+		"000001-4-alter-b: ALTER TABLE `b` DROP FOREIGN KEY `fk_b_a`",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changeSets() = %q, want %q", got, want)
+	}
+
+	sets = changeSets("000002", cyclePlan(alterTypeDrop), nil)
+	if len(sets) != 4 || !strings.HasPrefix(sets[0].Rollback[0], "ALTER TABLE `a` ADD CONSTRAINT `fk_a_b`") ||
+		strings.Contains(sets[2].Rollback[0], "CONSTRAINT") {
+		t.Errorf("changeSets() of drop = %+v", sets)
+	}
+	if _, err := liquibaseYAML(sets); nil != err {
+		t.Errorf("liquibaseYAML() error: %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+// Migration files: golang-migrate, flyway and liquibase
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"struct_sync/logger"
+	"time"
+)
+
+const (
+	OutputFormatSQL           = "sql"            // dated <db>@<host>#<port>.sql files
+	OutputFormatMigrate       = "migrate"        // golang-migrate NNN_name.up.sql / NNN_name.down.sql
+	OutputFormatFlyway        = "flyway"         // flyway V<n>__name.sql, U<n>__name.sql undo
+	OutputFormatLiquibase     = "liquibase"      // liquibase NNN_name.xml changelog
+	OutputFormatLiquibaseYaml = "liquibase-yaml" // liquibase NNN_name.yaml changelog
+)
+
+// Supported output formats
+var OutputFormats = []string{OutputFormatSQL, OutputFormatMigrate, OutputFormatFlyway, OutputFormatLiquibase, OutputFormatLiquibaseYaml}
+
+// version width of the timestamp versions, as migrate create (default format)
+const migrationTimestampWidth = 14
+
+// file written to the migrations directory
+type migrationFile struct {
+	Name    string
+	Content string
+}
+
+// migrations directory layout of an output format
+type migrationFormat struct {
+	fileReg *regexp.Regexp // version of the existing files is the first group
+	width   int            // version width of a new directory
+	files   func(version, name string, plan []*TableAlterData, objAlters []*ObjectAlterData) ([]migrationFile, error)
+}
+
+var migrationFormats = map[string]*migrationFormat{
+	OutputFormatMigrate: {
+		fileReg: regexp.MustCompile(`^(\d+)_.*\.(up|down)\.sql$`),
+		width:   6, // as migrate create -seq
+		files: func(version, name string, plan []*TableAlterData, objAlters []*ObjectAlterData) ([]migrationFile, error) {
+			base := version + "_" + name
+			return []migrationFile{
+				{base + ".up.sql", upScript(plan, objAlters)},
+				{base + ".down.sql", downScript(plan, objAlters, false)},
+			}, nil
+		},
+	},
+	OutputFormatFlyway: {
+		fileReg: regexp.MustCompile(`^[VU](\d+)(?:[._]\d+)*__.*\.sql$`),
+		width:   1,
+		files: func(version, name string, plan []*TableAlterData, objAlters []*ObjectAlterData) ([]migrationFile, error) {
+			// Flyway reads DELIMITER of mysql scripts
+			return []migrationFile{
+				{"V" + version + "__" + name + ".sql", alterScript(plan, objAlters)},
+				{"U" + version + "__" + name + ".sql", downScript(plan, objAlters, true)},
+			}, nil
+		},
+	},
+	OutputFormatLiquibase: {
+		fileReg: regexp.MustCompile(`^(\d+)_.*\.xml$`),
+		width:   6,
+		files: func(version, name string, plan []*TableAlterData, objAlters []*ObjectAlterData) ([]migrationFile, error) {
+			content := liquibaseXML(changeSets(version, plan, objAlters))
+			return []migrationFile{{version + "_" + name + ".xml", content}}, nil
+		},
+	},
+	OutputFormatLiquibaseYaml: {
+		fileReg: regexp.MustCompile(`^(\d+)_.*\.ya?ml$`),
+		width:   6,
+		files: func(version, name string, plan []*TableAlterData, objAlters []*ObjectAlterData) ([]migrationFile, error) {
+			content, err := liquibaseYAML(changeSets(version, plan, objAlters))
+			return []migrationFile{{version + "_" + name + ".yaml", content}}, err
+		},
+	},
+}
+
+/**
+* Output format writes to a migrations directory
+ */
+func isMigrationFormat(format string) bool {
+	return nil != migrationFormats[format]
+}
+
+/**
+* Write the migration files of the changes to dir in the output format, continue the version sequence of the dir.
+* return the first file name, empty when nothing changed
+ */
+func writeMigration(dir, name string, plan []*TableAlterData, objAlters []*ObjectAlterData) (string, error) {
+	format := migrationFormats[globalSet.OutputFormat]
+	if len(plan) == 0 && len(objAlters) == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); nil != err {
+		return "", err
+	}
+
+	version, err := nextMigrationVersion(dir, format)
+	if nil != err {
+		return "", err
+	}
+
+	files, err := format.files(version, migrationName(name, plan, objAlters), plan, objAlters)
+	if nil != err {
+		return "", err
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name), []byte(file.Content), 0644); nil != err {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, files[0].Name), nil
+}
+
+/**
+* Next version of the migrations dir, same width as the existing ones
+ */
+func nextMigrationVersion(dir string, format *migrationFormat) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if nil != err {
+		return "", err
+	}
+
+	var last uint64
+	width := format.width
+	for _, file := range files {
+		m := format.fileReg.FindStringSubmatch(file.Name())
+		if nil == m {
+			continue
+		}
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if nil != err {
+			return "", fmt.Errorf("invalid migration version %s: %s", file.Name(), err.Error())
+		}
+		if version >= last {
+			last = version
+			width = len(m[1])
+		}
+	}
+
+	next := last + 1
+	if width >= migrationTimestampWidth { // timestamp versions
+		if now, _ := strconv.ParseUint(time.Now().Format("20060102150405"), 10, 64); now > last {
+			next = now
+		}
+	}
+	return fmt.Sprintf("%0*d", width, next), nil
+}
+
+/**
+* Migration name, the change of one table or object, else sync_<name>
+ */
+func migrationName(name string, plan []*TableAlterData, objAlters []*ObjectAlterData) string {
+	if len(plan) == 1 && len(objAlters) == 0 {
+		name = plan[0].Type.String() + "_" + plan[0].Table
+	} else if len(plan) == 0 && len(objAlters) == 1 {
+		name = objAlters[0].Type.String() + "_" + strings.ToLower(objAlters[0].Object.Type) + "_" + objAlters[0].Object.Name
+	} else {
+		name = "sync_" + name
+	}
+
+	var buf strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			buf.WriteRune(c)
+		} else if buf.Len() > 0 && !strings.HasSuffix(buf.String(), "_") {
+			buf.WriteByte('_')
+		}
+	}
+	name = strings.Trim(buf.String(), "_")
+	if len(name) > 60 {
+		name = strings.TrimRight(name[:60], "_")
+	}
+	return name
+}
+
+/**
+* Up migration, the objects without DELIMITER (migrate runs the file as multi statements)
+ */
+func upScript(plan []*TableAlterData, objAlters []*ObjectAlterData) string {
+	var buf strings.Builder
+	buf.WriteString(alterScript(plan, nil))
+	for _, oa := range objAlters {
+		for _, sql := range oa.SQL {
+			buf.WriteString(sql + ";\n")
+		}
+	}
+	return buf.String()
+}
+
+/**
+* Down migration, the reverse of each change in reverse order. delimited: routines and triggers with DELIMITER
+ */
+func downScript(plan []*TableAlterData, objAlters []*ObjectAlterData, delimited bool) string {
+	var buf strings.Builder
+	for i := len(objAlters) - 1; i >= 0; i-- {
+		reverse := objAlters[i].reverse()
+		if delimited {
+			buf.WriteString(reverse.fileSQL())
+			continue
+		}
+		for _, sql := range reverse.SQL {
+			buf.WriteString(sql + ";\n")
+		}
+	}
+
+	var tableSQL []string
+	for i := len(plan) - 1; i >= 0; i-- {
+		if sql := reverseAlterSQL(plan[i]); "" != sql {
+			tableSQL = append(tableSQL, sql)
+		}
+	}
+	if globalSet.ForeignKeyChecksOff && len(tableSQL) > 0 {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	}
+	for _, sql := range tableSQL {
+		buf.WriteString(sql + ";\n")
+	}
+	if globalSet.ForeignKeyChecksOff && len(tableSQL) > 0 {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+	return buf.String()
+}
+
+/**
+* Change to restore the dest object
+ */
+func (oa *ObjectAlterData) reverse() *ObjectAlterData {
+	switch oa.Type {
+	case alterTypeCreate:
+		return &ObjectAlterData{Object: oa.Object, Type: alterTypeDrop, SQL: []string{oa.Object.dropSQL()}}
+	case alterTypeAlter:
+		return &ObjectAlterData{Object: oa.Old, Old: oa.Object, Type: alterTypeAlter, SQL: []string{oa.Object.dropSQL(), oa.Old.SQL}}
+	case alterTypeDrop:
+		return &ObjectAlterData{Object: oa.Object, Type: alterTypeCreate, SQL: []string{oa.Object.SQL}}
+	}
+	return &ObjectAlterData{Object: oa.Object, Type: alterTypeNo}
+}
+
+/**
+* Statement to restore the dest table, the reverse of each change of getSchemaDiff
+ */
+func reverseAlterSQL(alter *TableAlterData) string {
+	switch alter.Type {
+	case alterTypeCreate:
+		return fmt.Sprintf("DROP TABLE `%s`", alter.Table)
+	case alterTypeDrop:
+		return alter.SchemaDiff.Dest.SchemaRawNoInc
+	case alterTypeAlter:
+	default:
+		return ""
+	}
+
+	source := alter.SchemaDiff.Source
+	dest := alter.SchemaDiff.Dest
+	if nil == source || nil == dest {
+		return reverseForeignKeySQL(alter)
+	}
+	var lines []string
+
+	// Foreign keys first, they may use the indexes and columns
+	lines = append(lines, reverseIndexSQL(source.ForeignAll, dest.ForeignAll)...)
+	lines = append(lines, reverseIndexSQL(source.IndexAll, dest.IndexAll)...)
+
+	for _, name := range sortedStringKeys(source.Fields) {
+		dt := source.FieldSchemas[name]
+		if nil == dt {
+			continue
+		}
+		if destDt, has := dest.FieldSchemas[name]; has {
+			if fieldTypeChanged(dt, destDt) || dt.DefaultValue != destDt.DefaultValue {
+				lines = append(lines, fmt.Sprintf("CHANGE `%s` %s", name, dest.Fields[name]))
+			}
+		} else {
+			lines = append(lines, fmt.Sprintf("DROP `%s`", name))
+		}
+	}
+	if globalSet.DropUnecessary {
+		for _, name := range sortedStringKeys(dest.Fields) {
+			if _, has := source.Fields[name]; !has {
+				lines = append(lines, "ADD "+dest.Fields[name])
+			}
+		}
+	}
+
+	for _, name := range sortedStringKeys(source.Extend) {
+		destValue, has := dest.Extend[name]
+		if has && destValue == source.Extend[name] {
+			continue
+		}
+		if !has {
+			logger.Warn(fmt.Sprintf("Down migration of `%s`: %s was not set, not restored", alter.Table, name))
+			continue
+		}
+		if name == "CHARSET" {
+			lines = append(lines, "DEFAULT "+name+"="+destValue)
+		} else {
+			lines = append(lines, name+"="+destValue)
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE `%s` %s", alter.Table, strings.Join(lines, ",\n"))
+}
+
+/**
+* Reverse of the foreign key pass of a dependency cycle (see sortTableAlters):
+* drop the keys added to a created table, add back the keys dropped before drop table
+ */
+func reverseForeignKeySQL(alter *TableAlterData) string {
+	var lines []string
+	if source := alter.SchemaDiff.Source; nil != source {
+		for _, name := range sortedIndexNames(source.ForeignAll) {
+			lines = append(lines, source.ForeignAll[name].alterDropSQL())
+		}
+	} else if dest := alter.SchemaDiff.Dest; nil != dest {
+		for _, name := range sortedIndexNames(dest.ForeignAll) {
+			lines = append(lines, dest.ForeignAll[name].alterAddSQL(false))
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE `%s` %s", alter.Table, strings.Join(lines, ",\n"))
+}
+
+/**
+* Restore the dest indexes (or foreign keys) changed by the source
+ */
+func reverseIndexSQL(source, dest map[string]*DbIndex) []string {
+	var lines []string
+	for _, name := range sortedIndexNames(source) {
+		if dIdx, has := dest[name]; has {
+			if source[name].SQL != dIdx.SQL {
+				lines = append(lines, dIdx.alterAddSQL(true))
+			}
+		} else {
+			lines = append(lines, source[name].alterDropSQL())
+		}
+	}
+	if globalSet.DropUnecessary {
+		for _, name := range sortedIndexNames(dest) {
+			if _, has := source[name]; !has {
+				lines = append(lines, dest[name].alterAddSQL(false))
+			}
+		}
+	}
+	return lines
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return sortStrings(keys)
+}
+
+func sortedIndexNames(m map[string]*DbIndex) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return sortStrings(keys)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+)
+
+// two tables referencing each other
+var cycleSchemas = map[string]string{
+	"a": "CREATE TABLE `a` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `b_id` int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_a_b` (`b_id`),\n" +
+		"  CONSTRAINT `fk_a_b` FOREIGN KEY (`b_id`) REFERENCES `b` (`id`)\n" +
+		") ENGINE=InnoDB",
+	"b": "CREATE TABLE `b` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `a_id` int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_b_a` (`a_id`),\n" +
+		"  CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`)\n" +
+		") ENGINE=InnoDB",
+}
+
+/**
+* Create (or drop) plan of the foreign key cycle a <-> b
+ */
+func cyclePlan(alterType AlterType) []*TableAlterData {
+	var alters []*TableAlterData
+	for _, table := range []string{"b", "a"} {
+		alter := &TableAlterData{Table: table, Type: alterType, SchemaDiff: &SchemaDiff{Table: table}}
+		if alterTypeCreate == alterType {
+			alter.SchemaDiff.Source = ParseSchema(cycleSchemas[table])
+			alter.SQL = cycleSchemas[table] + ";"
+		} else {
+			alter.SchemaDiff.Dest = ParseSchema(cycleSchemas[table])
+			alter.SQL = "DROP TABLE `" + table + "`;"
+		}
+		alters = append(alters, alter)
+	}
+	return sortTableAlters(alters)
+}
+
+func TestDownScriptForeignKeyCycle(t *testing.T) {
+	globalSet = &GlobalSet{}
+
+	want := "ALTER TABLE `b` DROP FOREIGN KEY `fk_b_a`;\n" +
+		"ALTER TABLE `a` DROP FOREIGN KEY `fk_a_b`;\n" +
+		"DROP TABLE `b`;\n" +
+		"DROP TABLE `a`;\n"
+	if got := downScript(cyclePlan(alterTypeCreate), nil, false); got != want {
+		t.Errorf("down of create = %q, want %q", got, want)
+	}
+
+	want = "CREATE TABLE `b` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `a_id` int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_b_a` (`a_id`)\n" +
+		") ENGINE=InnoDB;\n" +
+		"CREATE TABLE `a` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `b_id` int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_a_b` (`b_id`)\n" +
+		") ENGINE=InnoDB;\n" +
+		"ALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);\n" +
+		"ALTER TABLE `a` ADD CONSTRAINT `fk_a_b` FOREIGN KEY (`b_id`) REFERENCES `b` (`id`);\n"
+	if got := downScript(cyclePlan(alterTypeDrop), nil, false); got != want {
+		t.Errorf("down of drop = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+// Offline schema diff, without db connection
+package service
+
+import (
+	"fmt"
+	"strings"
+	"struct_sync/logger"
+)
+
+/**
+* Compare the source schema with the dest schema, return the ordered table changes and object changes
+ */
+func diffSchemaSource(name string, source, dest *schemaSource) ([]*TableAlterData, []*ObjectAlterData) {
+	sc := &SchemaSync{DbSet: &DBSet{DbName: name}}
+
+	var alters []*TableAlterData
+	for _, table := range sortedTableNames(source.Tables) {
+		alter := sc.getAlterData(table, source.Tables[table], dest.Tables[table])
+		if alter.Type != alterTypeNo {
+			alters = append(alters, alter)
+		} else {
+			sc.addInfoLog("diffSchemaSource", fmt.Sprint("TABLE ", table, " Same"))
+		}
+	}
+
+	// Check Unecessary
+	if globalSet.DropUnecessary {
+		for _, table := range sortedTableNames(dest.Tables) {
+			if nil == source.Tables[table] {
+				alters = append(alters, sc.getAlterData(table, nil, dest.Tables[table]))
+				sc.addWarnLog("diffSchemaSource", fmt.Sprint("[TABLE.DROP] ", table))
+			}
+		}
+	}
+
+	var objAlters []*ObjectAlterData
+	if globalSet.SyncObjects {
+		objAlters = sc.diffObjects(source.Objects, dest.Objects, nil)
+	}
+	return sortTableAlters(alters), objAlters
+}
+
+/**
+* Adjust sql script of the changes
+ */
+func alterScript(plan []*TableAlterData, objAlters []*ObjectAlterData) string {
+	var buf strings.Builder
+	if globalSet.ForeignKeyChecksOff && len(plan) > 0 {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	}
+	for _, sd := range plan {
+		buf.WriteString(strings.TrimRight(strings.TrimSpace(sd.SQL), ";") + ";\n")
+	}
+	if globalSet.ForeignKeyChecksOff && len(plan) > 0 {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+	for _, oa := range objAlters {
+		buf.WriteString(oa.fileSQL())
+	}
+	return buf.String()
+}
+
+/**
+* Load a schema file or schema directory
+ */
+func loadSchemaPath(schemaPath string) (*schemaSource, error) {
+	if isDir, _ := pathIsDir(schemaPath); isDir {
+		files, err := readSchemaDir(schemaPath)
+		if nil != err {
+			return nil, err
+		}
+		return loadSchemaFiles(files)
+	}
+	return parseSchemaFile(schemaPath)
+}
+
+/**
+* Diff the source schema against the dest schema file (or directory), the schema at destRef of the git repository,
+* or the live database of the to dsn. save the adjust sql to output, or print it when output is empty
+ */
+func DiffSchema(dest, destRef, to, output string) ([]SyncRet, error) {
+	if "" != to {
+		return diffLiveDb(to, output)
+	}
+
+	if "" == dest && "" == destRef {
+		return nil, fmt.Errorf("diff dest not set, use -dest <file or dir>, -dest-ref <ref> or -to <dsn>")
+	}
+	name, destSource, err := loadDestSchema(dest, destRef)
+	if nil != err {
+		return nil, err
+	}
+
+	loadSourceSchema()
+	plan, objAlters := diffSchemaSource(name, &schemaSource{Tables: gTableList, Objects: gObjectList}, destSource)
+	return writeDiffScript(name, plan, objAlters, output)
+}
+
+/**
+* Dest schema of the schema file (or directory), or the schema at destRef of the git repository
+ */
+func loadDestSchema(dest, destRef string) (string, *schemaSource, error) {
+	var destSource *schemaSource
+	var err error
+	name := dest
+	if "" != destRef {
+		name = destRef
+		destSource, err = loadGitSchema(destRef)
+	} else {
+		destSource, err = loadSchemaPath(dest)
+	}
+	if nil != err {
+		return name, nil, fmt.Errorf("load %s failed: %s", name, err.Error())
+	}
+	return name, destSource, nil
+}
+
+/**
+* Diff the source schema against a live database, nothing is executed
+ */
+func diffLiveDb(to, output string) ([]SyncRet, error) {
+	dbSet, err := dbSetFromDSN(to)
+	if nil != err {
+		return nil, fmt.Errorf("invalid -to dsn: %s", err.Error())
+	}
+	dbSet.timeout = globalSet.TimeOut
+
+	loadSourceSchema()
+	schemaSync := NewSchemaSync(dbSet)
+	if nil == schemaSync {
+		return nil, fmt.Errorf("connect %s failed", dbSet)
+	}
+	defer schemaSync.DestDb.Close()
+
+	plan, objAlters := schemaSync.alterPlan()
+	return writeDiffScript(dbSet.String(), plan, objAlters, output)
+}
+
+/**
+* Save the adjust sql to output, or print it, and report the changes
+ */
+func writeDiffScript(name string, plan []*TableAlterData, objAlters []*ObjectAlterData, output string) ([]SyncRet, error) {
+	printTableDiffs(name, plan)
+	if isMigrationFormat(globalSet.OutputFormat) {
+		dir := output
+		if "" == dir {
+			dir = globalSet.MigrationDir
+		}
+		if "" == dir || stdioPath == dir {
+			return nil, fmt.Errorf("migrations directory not set, use -o <dir> or MigrationDir")
+		}
+		fileName, err := writeMigration(dir, name, plan, objAlters)
+		if nil != err {
+			return nil, err
+		}
+		if "" != fileName {
+			fmt.Println("Write migration", fileName)
+		}
+	} else {
+		if "" == output {
+			output = stdioPath
+		}
+		if err := writeOutput(output, []byte(alterScript(plan, objAlters))); nil != err {
+			return nil, err
+		}
+	}
+
+	// Nothing is executed, report as a sync without execute
+	rets := []SyncRet{{Id: "0", DbName: name, Ret: syncRetSucceed, Changes: len(plan) + len(objAlters),
+		Tables: newTableRets(name, plan, objAlters)}}
+	logger.Info(rets[0])
+	printSyncSummary(rets)
+	writeJUnitReport(rets)
+	return rets, nil
+}
@@ -0,0 +1,337 @@
+// Pre-flight safety checks
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default max seconds a transaction may be open on the dest db
+const defaultMaxTrxTime = 60
+
+// pre-flight check, return the reason when the dest db is not safe to change
+type preCheckFunc func(sc *SchemaSync, alters []*TableAlterData) string
+
+var preChecks = []preCheckFunc{
+	checkPrivileges,
+	checkReadOnly,
+	checkReplicaLag,
+	checkLongTrx,
+	checkMetadataLock,
+}
+
+/**
+* Run pre-flight checks, retry when failed
+ */
+func (sc *SchemaSync) preCheck(alters []*TableAlterData) error {
+	interval, err := time.ParseDuration(globalSet.PreCheckInterval)
+	if nil != err || interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	var reason string
+	for i := 0; i <= globalSet.PreCheckRetry; i++ {
+		if i > 0 {
+			sc.addWarnLog("preCheck", fmt.Sprint("Pre-flight check failed, retry after ", interval, ": ", reason))
+			select {
+			case <-gCtx.Done():
+				return fmt.Errorf("pre-flight check canceled: %s", reason)
+			case <-time.After(interval):
+			}
+		}
+
+		reason = sc.runPreChecks(alters)
+		if "" == reason {
+			sc.addInfoLog("preCheck", "Pre-flight check passed")
+			return nil
+		}
+	}
+
+	sc.addErrorLog("preCheck", "Pre-flight check failed: "+reason)
+	return fmt.Errorf("pre-flight check failed: %s", reason)
+}
+
+/**
+* Run all checks once
+ */
+func (sc *SchemaSync) runPreChecks(alters []*TableAlterData) string {
+	for _, check := range preChecks {
+		if reason := check(sc, alters); "" != reason {
+			return reason
+		}
+	}
+	return ""
+}
+
+/**
+* Check the dest db is writable
+ */
+func checkReadOnly(sc *SchemaSync, alters []*TableAlterData) string {
+	_, rows, err := sc.DestDb.SqlQuery("SHOW GLOBAL VARIABLES WHERE Variable_name IN ('read_only', 'super_read_only')")
+	if nil != err {
+		sc.addWarnLog("checkReadOnly", "Query read_only failed, skip: "+err.Error())
+		return ""
+	}
+
+	for _, row := range rows {
+		if strings.EqualFold(row["Value"], "ON") || row["Value"] == "1" {
+			return fmt.Sprintf("%s=%s", row["Variable_name"], row["Value"])
+		}
+	}
+	return ""
+}
+
+/**
+* Check replica lag, only when MaxReplicaLag is set.
+* SHOW REPLICA STATUS of MySQL 8.0.22+ first, SHOW SLAVE STATUS (removed in 8.4) for the older servers
+ */
+func checkReplicaLag(sc *SchemaSync, alters []*TableAlterData) string {
+	if globalSet.MaxReplicaLag <= 0 {
+		return ""
+	}
+
+	num, rows, err := sc.DestDb.SqlQuery("SHOW REPLICA STATUS")
+	if nil != err {
+		var slaveErr error
+		if num, rows, slaveErr = sc.DestDb.SqlQuery("SHOW SLAVE STATUS"); nil != slaveErr {
+			return fmt.Sprintf("replica lag unknown, query replica status failed: %s; %s", err.Error(), slaveErr.Error())
+		}
+	}
+	if num < 1 { // not a replica
+		return ""
+	}
+
+	for _, row := range rows {
+		lagVal, has := row["Seconds_Behind_Source"]
+		if !has {
+			lagVal = row["Seconds_Behind_Master"]
+		}
+		if "" == lagVal {
+			return "replica lag unknown, replication is not running"
+		}
+
+		lag, _ := strconv.Atoi(lagVal)
+		if lag > globalSet.MaxReplicaLag {
+			return fmt.Sprintf("replica lag %ds exceeds %ds", lag, globalSet.MaxReplicaLag)
+		}
+	}
+	return ""
+}
+
+/**
+* Check long running transactions, they would block the DDL on metadata lock
+ */
+func checkLongTrx(sc *SchemaSync, alters []*TableAlterData) string {
+	maxTrxTime := globalSet.MaxTrxTime
+	if maxTrxTime <= 0 {
+		maxTrxTime = defaultMaxTrxTime
+	}
+
+	sql := fmt.Sprintf("SELECT trx_mysql_thread_id, TIMESTAMPDIFF(SECOND, trx_started, NOW()) AS trx_time"+
+		" FROM information_schema.innodb_trx WHERE trx_started < NOW() - INTERVAL %d SECOND", maxTrxTime)
+	num, rows, err := sc.DestDb.SqlQuery(sql)
+	if nil != err {
+		sc.addWarnLog("checkLongTrx", "Query innodb_trx failed, skip: "+err.Error())
+		return ""
+	}
+	if num > 0 {
+		return fmt.Sprintf("%d transaction(s) open longer than %ds, thread %s running %ss",
+			num, maxTrxTime, rows[0]["trx_mysql_thread_id"], rows[0]["trx_time"])
+	}
+	return ""
+}
+
+/**
+* Check metadata locks held or waited on the affected tables
+ */
+func checkMetadataLock(sc *SchemaSync, alters []*TableAlterData) string {
+	var tables []string
+	for _, alter := range alters {
+		if alter.Type != alterTypeCreate {
+			tables = append(tables, quoteString(alter.Table))
+		}
+	}
+
+	if len(tables) > 0 {
+		sql := fmt.Sprintf("SELECT OBJECT_NAME, LOCK_TYPE, LOCK_STATUS FROM performance_schema.metadata_locks"+
+			" WHERE OBJECT_TYPE = 'TABLE' AND OBJECT_SCHEMA = %s AND OBJECT_NAME IN (%s)",
+			quoteString(sc.DbSet.DbName), strings.Join(tables, ","))
+		num, rows, err := sc.DestDb.SqlQuery(sql)
+		if nil != err {
+			sc.addWarnLog("checkMetadataLock", "Query metadata_locks failed, use processlist: "+err.Error())
+		} else if num > 0 {
+			return fmt.Sprintf("metadata lock %s (%s) on table `%s`",
+				rows[0]["LOCK_TYPE"], rows[0]["LOCK_STATUS"], rows[0]["OBJECT_NAME"])
+		}
+	}
+
+	sql := fmt.Sprintf("SELECT ID, TIME, STATE FROM information_schema.PROCESSLIST"+
+		" WHERE DB = %s AND STATE LIKE '%%metadata lock%%'", quoteString(sc.DbSet.DbName))
+	num, rows, err := sc.DestDb.SqlQuery(sql)
+	if nil != err {
+		sc.addWarnLog("checkMetadataLock", "Query processlist failed, skip: "+err.Error())
+		return ""
+	}
+	if num > 0 {
+		return fmt.Sprintf("thread %s '%s' for %ss", rows[0]["ID"], rows[0]["STATE"], rows[0]["TIME"])
+	}
+	return ""
+}
+
+/**
+* Check the dest user has the privileges the adjust sql needs
+ */
+func checkPrivileges(sc *SchemaSync, alters []*TableAlterData) string {
+	need := make(map[string]bool)
+	for _, alter := range alters {
+		switch alter.Type {
+		case alterTypeCreate:
+			need["CREATE"] = true
+		case alterTypeDrop:
+			need["DROP"] = true
+		case alterTypeAlter:
+			need["ALTER"] = true
+			need["CREATE"] = true
+			need["INSERT"] = true
+		}
+		if alter.SchemaDiff != nil && alter.SchemaDiff.Source != nil && len(alter.SchemaDiff.Source.ForeignAll) > 0 {
+			need["REFERENCES"] = true
+		}
+	}
+	if len(need) == 0 {
+		return ""
+	}
+
+	_, rows, err := sc.DestDb.SqlQuery("SHOW GRANTS")
+	if nil != err {
+		sc.addWarnLog("checkPrivileges", "Query grants failed, skip: "+err.Error())
+		return ""
+	}
+
+	// The privileges of the granted roles, mysql 8.0
+	var roles []string
+	for _, row := range rows {
+		for _, grant := range row {
+			roles = append(roles, parseRoleGrant(grant)...)
+		}
+	}
+	if len(roles) > 0 {
+		_, roleRows, err := sc.DestDb.SqlQuery("SHOW GRANTS FOR CURRENT_USER() USING " + strings.Join(roles, ", "))
+		if nil != err {
+			sc.addWarnLog("checkPrivileges", "Query grants of the roles failed, skip: "+err.Error())
+			return ""
+		}
+		rows = append(rows, roleRows...)
+	}
+
+	granted := make(map[string]bool)
+	for _, row := range rows {
+		for _, grant := range row {
+			privs, on := parseGrant(grant)
+			if !grantOnDb(on, sc.DbSet.DbName) {
+				continue
+			}
+			for _, priv := range privs {
+				granted[priv] = true
+			}
+		}
+	}
+	if granted["ALL PRIVILEGES"] {
+		return ""
+	}
+
+	var missing []string
+	for priv := range need {
+		if !granted[priv] {
+			missing = append(missing, priv)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "missing privileges: " + strings.Join(missing, ", ")
+	}
+	return ""
+}
+
+/**
+* Parser grant line, ex: GRANT SELECT, ALTER ON `db`.* TO 'user'@'%'
+ */
+func parseGrant(grant string) ([]string, string) {
+	if !strings.HasPrefix(grant, "GRANT ") {
+		return nil, ""
+	}
+	onIdx := strings.Index(grant, " ON ")
+	toIdx := strings.Index(grant, " TO ")
+	if onIdx < 0 || toIdx < onIdx {
+		return nil, ""
+	}
+
+	var privs []string
+	for _, priv := range strings.Split(grant[len("GRANT "):onIdx], ",") {
+		privs = append(privs, strings.ToUpper(strings.TrimSpace(priv)))
+	}
+	on := strings.TrimSpace(grant[onIdx+len(" ON ") : toIdx])
+	return privs, on
+}
+
+/**
+* Roles of a role grant line, ex: GRANT `app_read`@`%`,`app_write`@`%` TO 'user'@'%'
+ */
+func parseRoleGrant(grant string) []string {
+	toIdx := strings.Index(grant, " TO ")
+	if !strings.HasPrefix(grant, "GRANT ") || toIdx < 0 || strings.Contains(grant[:toIdx], " ON ") {
+		return nil
+	}
+
+	var roles []string
+	for _, role := range splitOutsideQuotes(grant[len("GRANT "):toIdx], ',') {
+		if role = strings.TrimSpace(role); "" != role {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+/**
+* The grant is on all the databases or the whole database, ex: *.* , `db`.* , `app\_%`.*
+* A table or routine grant is not. The database name is a LIKE pattern, \_ and \% are the literal characters
+ */
+func grantOnDb(on, dbName string) bool {
+	if "*.*" == on {
+		return true
+	}
+	if !strings.HasPrefix(on, "`") || !strings.HasSuffix(on, "`.*") {
+		return false
+	}
+	pattern := strings.Replace(on[1:len(on)-len("`.*")], "``", "`", -1)
+	return likeMatch(strings.ToLower(pattern), strings.ToLower(dbName))
+}
+
+/**
+* Match the sql LIKE pattern: % any characters, _ one character, \ escapes the next character
+ */
+func likeMatch(pattern, str string) bool {
+	p, s := []rune(pattern), []rune(str)
+	if len(p) == 0 {
+		return len(s) == 0
+	}
+	switch p[0] {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if likeMatch(string(p[1:]), string(s[i:])) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return len(s) > 0 && likeMatch(string(p[1:]), string(s[1:]))
+	case '\\':
+		if len(p) > 1 {
+			p = p[1:]
+		}
+	}
+	return len(s) > 0 && p[0] == s[0] && likeMatch(string(p[1:]), string(s[1:]))
+}
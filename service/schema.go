@@ -119,6 +119,9 @@ func parseSchemaExtend(line string) map[string]string {
 		}
 
 		index := strings.Index(v, "=")
+		if index < 0 { // not key=value
+			continue
+		}
 		name := strings.TrimSpace(v[:index])
 		value := strings.TrimSpace(v[index+1:])
 		if "AUTO_INCREMENT" != name { // ignore auto inc
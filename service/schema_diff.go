@@ -1,5 +1,11 @@
 package service
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type SchemaDiff struct {
 	Table  string
 	Source *MySchema
@@ -21,5 +27,83 @@ func newSchemaDiff(table, dest string, source *MySchema) *SchemaDiff {
 * Get relation tables
  */
 func (sDiff *SchemaDiff) RelationTables() []string {
+	if nil == sDiff.Source { // table to drop, use dest relation
+		if nil == sDiff.Dest {
+			return nil
+		}
+		return sDiff.Dest.RelationTables()
+	}
 	return sDiff.Source.RelationTables()
 }
+
+/**
+* Compare two parsed schemas, return the differences of dest to source.
+* strict: report fields, indexes and foreign keys only exists in dest
+ */
+func compareSchema(source, dest *MySchema, strict bool) []string {
+	var diffs []string
+	if nil == dest {
+		return []string{"table not exists"}
+	}
+
+	compareItems := func(kind string, src, dst map[string]string) {
+		for name, s := range src {
+			if d, has := dst[name]; !has {
+				diffs = append(diffs, fmt.Sprintf("%s `%s` missing", kind, name))
+			} else if s != d {
+				diffs = append(diffs, fmt.Sprintf("%s `%s` differs: %s <> %s", kind, name, d, s))
+			}
+		}
+		if strict {
+			for name := range dst {
+				if _, has := src[name]; !has {
+					diffs = append(diffs, fmt.Sprintf("%s `%s` unnecessary", kind, name))
+				}
+			}
+		}
+	}
+
+	compareItems("COLUMN", normalizedFields(source.Fields), normalizedFields(dest.Fields))
+	compareItems("INDEX", indexSQLMap(source.IndexAll), indexSQLMap(dest.IndexAll))
+	compareItems("FOREIGN_KEY", indexSQLMap(source.ForeignAll), indexSQLMap(dest.ForeignAll))
+	for name, s := range source.Extend {
+		if d := dest.Extend[name]; s != d {
+			diffs = append(diffs, fmt.Sprintf("EXTEND `%s` differs: %s <> %s", name, d, s))
+		}
+	}
+
+	sort.Strings(diffs)
+	return diffs
+}
+
+func indexSQLMap(indexAll map[string]*DbIndex) map[string]string {
+	sqls := make(map[string]string, len(indexAll))
+	for name, idx := range indexAll {
+		sqls[name] = idx.SQL
+	}
+	return sqls
+}
+
+/**
+* Column definitions with the normalized types, int unsigned (file) is same as int(10) unsigned (MySQL 5.7)
+ */
+func normalizedFields(fields map[string]string) map[string]string {
+	normalized := make(map[string]string, len(fields))
+	for name, line := range fields {
+		normalized[name] = normalizeFieldLine(line)
+	}
+	return normalized
+}
+
+/**
+* Column definition with the normalized type, ex: `id` int(10) unsigned NOT NULL -> `id` int unsigned NOT NULL
+ */
+func normalizeFieldLine(line string) string {
+	fs := parseFieldSchema(line)
+	end := strings.Index(line[1:], "`") + 2
+	def := strings.TrimSpace(line[end:])
+	if "" == fs.ColumnType || len(def) < len(fs.ColumnType) || !strings.EqualFold(def[:len(fs.ColumnType)], fs.ColumnType) {
+		return line
+	}
+	return line[:end] + " " + normalizeColumnType(fs.ColumnType) + def[len(fs.ColumnType):]
+}
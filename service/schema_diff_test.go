@@ -0,0 +1,33 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareSchema(t *testing.T) {
+	source := ParseSchema("CREATE TABLE `user` (\n" +
+		"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `age` tinyint DEFAULT NULL,\n" +
+		"  `flag` bool NOT NULL,\n" +
+		"  `name` varchar(20) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB")
+	dest := ParseSchema("CREATE TABLE `user` (\n" +
+		"  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `age` tinyint(4) DEFAULT NULL,\n" +
+		"  `flag` tinyint(1) NOT NULL,\n" +
+		"  `name` varchar(32) NOT NULL,\n" +
+		"  `note` text,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB")
+
+	want := []string{"COLUMN `name` differs: `name` varchar(32) NOT NULL <> `name` varchar(20) NOT NULL"}
+	if got := compareSchema(source, dest, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("compareSchema() = %q, want %q", got, want)
+	}
+	want = append(want, "COLUMN `note` unnecessary")
+	if got := compareSchema(source, dest, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("compareSchema() strict = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,235 @@
+// Schema-as-code directory source
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"struct_sync/logger"
+)
+
+// default schema file pattern
+const defaultSchemaFileGlob = "*.sql"
+
+// sub directory of each object type in schema directory
+type SchemaLayout struct {
+	Tables   string // default tables
+	Views    string // default views
+	Routines string // procedures and functions, default routines
+	Triggers string // default triggers
+}
+
+// schema file content
+type schemaFile struct {
+	Path    string
+	Content string
+}
+
+// parsed source schema
+type schemaSource struct {
+	Tables  map[string]*MySchema
+	Objects []*DbObject
+}
+
+/**
+* Sub directory of each object type, with the default layout
+ */
+func schemaLayout() map[string]string {
+	layout := SchemaLayout{Tables: "tables", Views: "views", Routines: "routines", Triggers: "triggers"}
+	if set := globalSet.SchemaLayout; nil != set {
+		if "" != set.Tables {
+			layout.Tables = set.Tables
+		}
+		if "" != set.Views {
+			layout.Views = set.Views
+		}
+		if "" != set.Routines {
+			layout.Routines = set.Routines
+		}
+		if "" != set.Triggers {
+			layout.Triggers = set.Triggers
+		}
+	}
+
+	return map[string]string{
+		objectTypeTable:     layout.Tables,
+		objectTypeView:      layout.Views,
+		objectTypeProcedure: layout.Routines,
+		objectTypeFunction:  layout.Routines,
+		objectTypeTrigger:   layout.Triggers,
+	}
+}
+
+/**
+* Read the schema files in the layout directories, recursively
+ */
+func readSchemaDir(dir string) ([]schemaFile, error) {
+	glob, err := schemaFileGlob()
+	if nil != err {
+		return nil, err
+	}
+
+	var paths []string
+	found := make(map[string]bool)
+	for _, sub := range schemaLayout() {
+		subDir := filepath.Join(dir, sub)
+		if exists, _ := pathIsDir(subDir); !exists {
+			continue
+		}
+
+		err := filepath.Walk(subDir, func(path string, info os.FileInfo, err error) error {
+			if nil != err {
+				return err
+			}
+			if info.IsDir() || found[path] {
+				return nil
+			}
+			if match, _ := filepath.Match(glob, info.Name()); match {
+				found[path] = true
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if nil != err {
+			return nil, err
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no schema file [%s] found in %s", glob, dir)
+	}
+	sort.Strings(paths)
+
+	files := make([]schemaFile, 0, len(paths))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if nil != err {
+			return nil, err
+		}
+		files = append(files, schemaFile{Path: path, Content: string(data)})
+	}
+	return files, nil
+}
+
+/**
+* Schema file pattern, default *.sql
+ */
+func schemaFileGlob() (string, error) {
+	glob := globalSet.SchemaFileGlob
+	if "" == glob {
+		glob = defaultSchemaFileGlob
+	}
+	if _, err := filepath.Match(glob, ""); nil != err {
+		return "", fmt.Errorf("invalid schema file glob [%s]: %s", glob, err.Error())
+	}
+	return glob, nil
+}
+
+/**
+* Parser schema files, report the duplicate and conflicting definitions
+ */
+func loadSchemaFiles(files []schemaFile) (*schemaSource, error) {
+	source := &schemaSource{Tables: make(map[string]*MySchema)}
+	definedIn := make(map[string]string) // object key -> file
+	objects := make(map[string]*DbObject)
+	var conflicts []string
+
+	define := func(key, path, sql, definedSQL string) bool {
+		oldPath, has := definedIn[key]
+		if !has {
+			definedIn[key] = path
+			return true
+		}
+
+		if collapseSpace(sql) == collapseSpace(definedSQL) {
+			logger.Warn(fmt.Sprintf("Duplicate definition of %s in %s and %s", key, oldPath, path))
+		} else {
+			conflicts = append(conflicts, fmt.Sprintf("%s defined differently in %s and %s", key, oldPath, path))
+		}
+		return false
+	}
+
+	for _, file := range files {
+		content := file.Content
+		if isYamlSchemaFile(file.Path) {
+			sql, err := yamlSchemaSQL(file.Path, content)
+			if nil != err {
+				return nil, fmt.Errorf("%s: %s", file.Path, err.Error())
+			}
+			content = sql
+		}
+
+		tables, objs, err := parseSchemaStatements(splitSQLStatements(content))
+		if nil != err {
+			return nil, fmt.Errorf("%s: %s", file.Path, err.Error())
+		}
+
+		for _, name := range sortedTableNames(tables) {
+			key := fmt.Sprintf("%s `%s`", objectTypeTable, name)
+			var definedSQL string
+			if old, has := source.Tables[name]; has {
+				definedSQL = old.SchemaRawNoInc
+			}
+			if define(key, file.Path, tables[name].SchemaRawNoInc, definedSQL) {
+				source.Tables[name] = tables[name]
+			}
+		}
+
+		for _, obj := range objs {
+			var definedSQL string
+			if old, has := objects[obj.String()]; has {
+				definedSQL = old.SQL
+			}
+			if define(obj.String(), file.Path, obj.SQL, definedSQL) {
+				objects[obj.String()] = obj
+				source.Objects = append(source.Objects, obj)
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		for _, conflict := range conflicts {
+			logger.Error("Conflicting definition:", conflict)
+		}
+		return nil, fmt.Errorf("%d conflicting definition(s), first: %s", len(conflicts), conflicts[0])
+	}
+
+	sortObjects(source.Objects)
+	return source, nil
+}
+
+/**
+* Load the schema directory as source
+ */
+func loadSchemaDir() {
+	files, err := readSchemaDir(globalSet.InputDir)
+	if nil == err {
+		var source *schemaSource
+		if source, err = loadSchemaFiles(files); nil == err {
+			setSourceSchema(source)
+			return
+		}
+	}
+
+	logger.Fatal("Load Schema Dir Failed:", err.Error())
+	panic("Load Schema Dir Failed: " + err.Error())
+}
+
+func pathIsDir(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if nil != err {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+/**
+* File of the object in the schema directory
+ */
+func objectFileName(dir, objType, name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	return filepath.Join(dir, schemaLayout()[objType], name+".sql")
+}
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"struct_sync/common"
 	"struct_sync/logger"
 	"struct_sync/model"
 	"strings"
+	"time"
 )
 
 type SchemaSync struct {
@@ -17,17 +19,15 @@ type SchemaSync struct {
 * Create dest db connection
  */
 func NewSchemaSync(dbset *DBSet) *SchemaSync {
-	// root:123456@tcp(127.0.0.1:3306)/sbsp?charset=utf8
-	dest_dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&timeout=%s",
-		dbset.User,
-		dbset.Pswd,
-		dbset.Host,
-		dbset.Port,
-		dbset.DbName,
-		dbset.Charset,
-		dbset.timeout)
 	sc := &SchemaSync{DbSet: dbset}
-	db, err := model.NewMysqlDb(dest_dsn)
+	dsn := dbset.dsn(dbset.DbName)
+	if globalSet.ForeignKeyChecksOff {
+		dsn += "&foreign_key_checks=0"
+	}
+	if globalSet.LockWaitTimeout > 0 {
+		dsn += fmt.Sprintf("&lock_wait_timeout=%d", globalSet.LockWaitTimeout)
+	}
+	db, err := model.NewMysqlDb(dsn)
 	if nil != err {
 		sc.addFatalLog("NewSchemaSync", fmt.Sprintln("Connect db failed: ", err.Error()))
 		return nil
@@ -85,14 +85,12 @@ func (sc *SchemaSync) getSchemaDiff(alert *TableAlterData) string {
 		var alertSQL = ""
 		s, _ := ssource.Fields[name]
 		if destDt, has := dsource.FieldSchemas[name]; has {
-			if dt.FieldLen != destDt.FieldLen ||
-				dt.FieldType != destDt.FieldType ||
+			if fieldTypeChanged(dt, destDt) ||
 				dt.DefaultValue != destDt.DefaultValue { // exist, but diff
 				alertSQL = fmt.Sprintf("CHANGE `%s` %s", name, s)
 			}
 		} else { // not exist, append field to dest
 			alertSQL = "ADD " + s
-			fmt.Println("Souce Table: ", table, " Field:", s)
 		}
 
 		if "" != alertSQL {
@@ -125,7 +123,7 @@ func (sc *SchemaSync) getSchemaDiff(alert *TableAlterData) string {
 		if dIdx, has := dsource.IndexAll[indexName]; has {
 			if idx.SQL != dIdx.SQL {
 				alertSQL = idx.alterAddSQL(true)
-				fmt.Println("Index Check: ", table, idx.SQL, dIdx.SQL)
+				sc.addInfoLog("getSchemaDiff", fmt.Sprint("[INDEX.CHECK] ", table, " source: ", idx.SQL, ", dest: ", dIdx.SQL))
 			}
 		} else {
 			alertSQL = idx.alterAddSQL(false)
@@ -231,39 +229,94 @@ func (sc *SchemaSync) getSchemaDiff(alert *TableAlterData) string {
 	return strings.Join(alterLines, ",\n")
 }
 
+/**
+* Compare the source schema with the dest db, return the table changes in execute order and the object changes
+ */
+func (sc *SchemaSync) alterPlan() ([]*TableAlterData, []*ObjectAlterData) {
+	var alters []*TableAlterData
+	for table, _ := range gTableList {
+		sd := sc.getAlterDataByTable(table)
+		if sd.Type != alterTypeNo {
+			alters = append(alters, sd)
+		} else {
+			var s = fmt.Sprintf("%s@%s TABLE %s Same", sc.DbSet.DbName, sc.DbSet.Host, table)
+			logger.Info(s)
+		}
+	}
+
+	//Check Unecessary
+	if globalSet.DropUnecessary {
+		destTableList := sc.DestDb.GetTableNames()
+
+		for _, table := range destTableList {
+			if gTableList[table] == nil {
+				alter := &TableAlterData{Table: table, Type: alterTypeDrop}
+				dropSQL := fmt.Sprintf("DROP TABLE `%s`", table)
+				alter.SQL = dropSQL
+				destSchema, _ := sc.DestDb.GetTableSchema(table)
+				alter.SchemaDiff = newSchemaDiff(table, destSchema, nil)
+				alters = append(alters, alter)
+
+				sc.addWarnLog("alterPlan",
+					fmt.Sprint("[TABLE.DROP] ", table, ", SQL=", dropSQL))
+			}
+		}
+	}
+
+	var objAlters []*ObjectAlterData
+	if globalSet.SyncObjects {
+		objAlters = sc.getObjectAlters()
+	}
+
+	// Order by foreign key dependency
+	return sortTableAlters(alters), objAlters
+}
+
 /**
 * Get Alter Database table info
  */
 func (sc *SchemaSync) getAlterDataByTable(table string) *TableAlterData {
-	alter := &TableAlterData{Table: table, Type: alterTypeNo}
-	var srcSchema = gTableList[table].SchemaRaw
-	var srcSchema2 = gTableList[table].SchemaRawNoInc
 	destSchema, err := sc.DestDb.GetTableSchema(table)
 	if nil != err {
 		sc.addWarnLog("getAlterDataByTable", fmt.Sprint("GetTableSchema Failed!", err.Error()))
 	}
 
-	var destSchema2 = common.RemoveAutoIncrement(destSchema)
-	if srcSchema2 == destSchema2 { // struct is same
-		return alter
+	if gTableList[table].SchemaRawNoInc == common.RemoveAutoIncrement(destSchema) { // struct is same
+		return &TableAlterData{Table: table, Type: alterTypeNo}
 	}
 
-	alter.SchemaDiff = newSchemaDiff(table, destSchema, gTableList[table])
-	if destSchema != "" {
+	dest := ParseSchema(destSchema)
+	if nil != dest {
 		fldSchema, _ := sc.DestDb.GetColumnsSchema(table)
 		if fldSchema != nil {
-			alter.SchemaDiff.Dest.FieldSchemas = *fldSchema
+			dest.FieldSchemas = *fldSchema
 		}
 	}
-	if srcSchema == "" && globalSet.DropUnecessary {
-		alter.Type = alterTypeDrop
-		alter.SQL = fmt.Sprintf("DROP TABLE `%s`;\n", table)
+
+	return sc.getAlterData(table, gTableList[table], dest)
+}
+
+/**
+* Compare the source and dest table struct, nil means the table not exists
+ */
+func (sc *SchemaSync) getAlterData(table string, source, dest *MySchema) *TableAlterData {
+	alter := &TableAlterData{Table: table, Type: alterTypeNo}
+	if nil != source && nil != dest && source.SchemaRawNoInc == dest.SchemaRawNoInc { // struct is same
 		return alter
 	}
 
-	if destSchema == "" { // dest table is not exists
+	alter.SchemaDiff = &SchemaDiff{Table: table, Source: source, Dest: dest}
+	if nil == source {
+		if globalSet.DropUnecessary && nil != dest {
+			alter.Type = alterTypeDrop
+			alter.SQL = fmt.Sprintf("DROP TABLE `%s`;\n", table)
+		}
+		return alter
+	}
+
+	if nil == dest { // dest table is not exists
 		alter.Type = alterTypeCreate
-		alter.SQL = srcSchema + ";"
+		alter.SQL = source.SchemaRaw + ";"
 		return alter
 	}
 
@@ -287,13 +340,21 @@ func (sc *SchemaSync) SyncSQL2Dest(sql string, sqlList []string) error {
 		return nil
 	}
 
+	ctx, cancel := sc.stmtContext()
+	defer cancel()
+
 	t := NewMyTimer()
-	_, err := sc.DestDb.SqlExec(sql)
-	if nil != err && nil != sqlList && len(sqlList) > 0 {
-		tx, errTx := sc.DestDb.Db.Begin()
+	var err error
+	if globalSet.KillOnTimeout {
+		_, err = sc.DestDb.ExecKillOnTimeout(ctx, sql)
+	} else {
+		_, err = sc.DestDb.ExecContext(ctx, sql)
+	}
+	if nil != err && !model.IsTimeout(err) && !model.IsCanceled(err) && nil != sqlList && len(sqlList) > 0 {
+		tx, errTx := sc.DestDb.Db.BeginTx(ctx, nil)
 		if nil == errTx {
 			for _, sql := range sqlList {
-				_, err = tx.Exec(sql)
+				_, err = tx.ExecContext(ctx, sql)
 				if err != nil {
 					break
 				}
@@ -308,6 +369,14 @@ func (sc *SchemaSync) SyncSQL2Dest(sql string, sqlList []string) error {
 	}
 
 	t.Stop()
+	if model.IsTimeout(err) {
+		sc.addErrorLog("SyncSQL2Dest", fmt.Sprintln("execute sql timeout, used:", t.UsedSecond(), err.Error()))
+		return err
+	}
+	if model.IsCanceled(err) {
+		sc.addErrorLog("SyncSQL2Dest", fmt.Sprintln("execute sql canceled, used:", t.UsedSecond(), err.Error()))
+		return err
+	}
 	if nil != err {
 		sc.addErrorLog("SyncSQL2Dest", fmt.Sprintln("excute sql failed,", err.Error()))
 		return err
@@ -316,3 +385,48 @@ func (sc *SchemaSync) SyncSQL2Dest(sql string, sqlList []string) error {
 	sc.addInfoLog("SyncSQL2Dest", fmt.Sprintln("Execute sql succeed, used:", t.UsedSecond()))
 	return err
 }
+
+/**
+* Context of one statement, timeout with StmtTimeOut
+ */
+func (sc *SchemaSync) stmtContext() (context.Context, context.CancelFunc) {
+	timeout, err := time.ParseDuration(globalSet.StmtTimeOut)
+	if nil != err || timeout <= 0 {
+		return context.WithCancel(gCtx)
+	}
+	return context.WithTimeout(gCtx, timeout)
+}
+
+/**
+* Re-fetch the dest schema of the applied tables and compare again,
+* return the tables still different from the source
+ */
+func (sc *SchemaSync) verifyTables(alters []*TableAlterData) []string {
+	var drifts []string
+	verified := make(map[string]bool)
+	for _, alter := range alters {
+		if verified[alter.Table] {
+			continue
+		}
+		verified[alter.Table] = true
+
+		if nil == gTableList[alter.Table] { // table to drop
+			destSchema, _ := sc.DestDb.GetTableSchema(alter.Table)
+			if "" != destSchema {
+				drifts = append(drifts, fmt.Sprintf("`%s` not dropped", alter.Table))
+			}
+			continue
+		}
+
+		residual := sc.getAlterDataByTable(alter.Table)
+		if residual.Type != alterTypeNo {
+			drifts = append(drifts, fmt.Sprintf("`%s` %s", alter.Table, strings.TrimSpace(residual.SQL)))
+			sc.addErrorLog("verifyTables",
+				fmt.Sprint("[TABLE.DRIFT] ", alter.Table, " applied but still drifting, SQL=", residual.SQL))
+		} else {
+			sc.addInfoLog("verifyTables", fmt.Sprint("[TABLE.VERIFY] ", alter.Table, " Same"))
+		}
+	}
+
+	return drifts
+}
@@ -0,0 +1,326 @@
+// Declarative YAML / JSON schema format
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// declarative schema file
+type yamlSchema struct {
+	Tables []*yamlTable `yaml:"tables" json:"tables"`
+}
+
+type yamlTable struct {
+	Name        string            `yaml:"name" json:"name"`
+	Comment     string            `yaml:"comment,omitempty" json:"comment,omitempty"`
+	Options     string            `yaml:"options,omitempty" json:"options,omitempty"` // ex: ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	Columns     []*yamlColumn     `yaml:"columns" json:"columns"`
+	PrimaryKey  []string          `yaml:"primary_key,omitempty" json:"primary_key,omitempty"`
+	Indexes     []*yamlIndex      `yaml:"indexes,omitempty" json:"indexes,omitempty"`
+	ForeignKeys []*yamlForeignKey `yaml:"foreign_keys,omitempty" json:"foreign_keys,omitempty"`
+}
+
+type yamlColumn struct {
+	Name          string  `yaml:"name" json:"name"`
+	Type          string  `yaml:"type" json:"type"`
+	NotNull       bool    `yaml:"not_null,omitempty" json:"not_null,omitempty"`
+	AutoIncrement bool    `yaml:"auto_increment,omitempty" json:"auto_increment,omitempty"`
+	Default       *string `yaml:"default,omitempty" json:"default,omitempty"`
+	OnUpdate      string  `yaml:"on_update,omitempty" json:"on_update,omitempty"`
+	Charset       string  `yaml:"charset,omitempty" json:"charset,omitempty"`
+	Collate       string  `yaml:"collate,omitempty" json:"collate,omitempty"`
+	Comment       string  `yaml:"comment,omitempty" json:"comment,omitempty"`
+}
+
+type yamlIndex struct {
+	Name    string   `yaml:"name" json:"name"`
+	Columns []string `yaml:"columns" json:"columns"`
+	Unique  bool     `yaml:"unique,omitempty" json:"unique,omitempty"`
+	Type    string   `yaml:"type,omitempty" json:"type,omitempty"` // FULLTEXT or SPATIAL
+}
+
+type yamlForeignKey struct {
+	Name       string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Columns    []string `yaml:"columns" json:"columns"`
+	RefTable   string   `yaml:"ref_table" json:"ref_table"`
+	RefColumns []string `yaml:"ref_columns" json:"ref_columns"`
+	OnDelete   string   `yaml:"on_delete,omitempty" json:"on_delete,omitempty"`
+	OnUpdate   string   `yaml:"on_update,omitempty" json:"on_update,omitempty"`
+}
+
+/**
+* File is yaml or json schema, by the extension
+ */
+func isYamlSchemaFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ".yaml" == ext || ".yml" == ext || ".json" == ext
+}
+
+/**
+* Parser the yaml / json schema, validate it and return the create table sql
+ */
+func yamlSchemaSQL(path, content string) (string, error) {
+	var schema yamlSchema
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") { // unknown keys are errors as yaml, most likely a typo
+		decoder := json.NewDecoder(strings.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&schema); nil == err && decoder.More() {
+			err = fmt.Errorf("unexpected content after the schema")
+		}
+	} else {
+		err = yaml.UnmarshalStrict([]byte(content), &schema)
+	}
+	if nil != err {
+		return "", err
+	}
+
+	if errs := schema.validate(); len(errs) > 0 {
+		return "", fmt.Errorf("%d invalid definition(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+
+	var buf strings.Builder
+	for _, table := range schema.Tables {
+		buf.WriteString(table.tableDef().createSQL() + ";\n")
+	}
+	return buf.String(), nil
+}
+
+/**
+* Check the names, types and references
+ */
+func (ys *yamlSchema) validate() []string {
+	var errs []string
+	tables := make(map[string]*yamlTable)
+	for i, table := range ys.Tables {
+		if "" == table.Name {
+			errs = append(errs, fmt.Sprintf("table #%d: name missing", i+1))
+			continue
+		}
+		if _, has := tables[table.Name]; has {
+			errs = append(errs, fmt.Sprintf("table `%s`: defined more than once", table.Name))
+		}
+		tables[table.Name] = table
+	}
+
+	for _, table := range ys.Tables {
+		if "" == table.Name {
+			continue
+		}
+		prefix := fmt.Sprintf("table `%s`: ", table.Name)
+		if len(table.Columns) == 0 {
+			errs = append(errs, prefix+"no column")
+		}
+
+		columns := make(map[string]*yamlColumn)
+		for i, col := range table.Columns {
+			switch {
+			case "" == col.Name:
+				errs = append(errs, fmt.Sprintf("%scolumn #%d: name missing", prefix, i+1))
+				continue
+			case "" == col.Type:
+				errs = append(errs, fmt.Sprintf("%scolumn `%s`: type missing", prefix, col.Name))
+			case nil != col.Default && isBlobType(col.Type):
+				errs = append(errs, fmt.Sprintf("%scolumn `%s`: %s column can't have default", prefix, col.Name, col.Type))
+			}
+			if _, has := columns[col.Name]; has {
+				errs = append(errs, fmt.Sprintf("%scolumn `%s`: defined more than once", prefix, col.Name))
+			}
+			columns[col.Name] = col
+		}
+
+		checkColumns := func(what string, names []string) {
+			if len(names) == 0 {
+				errs = append(errs, prefix+what+": no column")
+			}
+			for _, name := range names {
+				if p := strings.Index(name, "("); p > 0 { // prefix length
+					name = name[:p]
+				}
+				if nil == columns[name] {
+					errs = append(errs, fmt.Sprintf("%s%s: column `%s` not exists", prefix, what, name))
+				}
+			}
+		}
+
+		if len(table.PrimaryKey) > 0 {
+			checkColumns("primary key", table.PrimaryKey)
+		}
+		indexNames := make(map[string]bool)
+		for _, idx := range table.Indexes {
+			what := fmt.Sprintf("index `%s`", idx.Name)
+			if "" == idx.Name {
+				errs = append(errs, prefix+"index name missing")
+			} else if indexNames[idx.Name] {
+				errs = append(errs, prefix+what+": defined more than once")
+			}
+			indexNames[idx.Name] = true
+			if "" != idx.Type && !inStringSlice(strings.ToUpper(idx.Type), []string{"FULLTEXT", "SPATIAL"}) {
+				errs = append(errs, fmt.Sprintf("%s%s: unsupported type %s", prefix, what, idx.Type))
+			}
+			checkColumns(what, idx.Columns)
+		}
+
+		for i, fk := range table.ForeignKeys {
+			what := fmt.Sprintf("foreign key #%d", i+1)
+			checkColumns(what, fk.Columns)
+			if len(fk.Columns) != len(fk.RefColumns) {
+				errs = append(errs, fmt.Sprintf("%s%s: %d columns reference %d columns", prefix, what, len(fk.Columns), len(fk.RefColumns)))
+			}
+			ref := tables[fk.RefTable]
+			if nil == ref {
+				errs = append(errs, fmt.Sprintf("%s%s: table `%s` not exists", prefix, what, fk.RefTable))
+				continue
+			}
+			for _, name := range fk.RefColumns {
+				found := false
+				for _, col := range ref.Columns {
+					found = found || col.Name == name
+				}
+				if !found {
+					errs = append(errs, fmt.Sprintf("%s%s: column `%s`.`%s` not exists", prefix, what, fk.RefTable, name))
+				}
+			}
+		}
+
+		autoInc := 0
+		for _, col := range table.Columns {
+			if col.AutoIncrement {
+				autoInc++
+				if !table.isKeyColumn(col.Name) {
+					errs = append(errs, fmt.Sprintf("%scolumn `%s`: auto_increment column must be a key", prefix, col.Name))
+				}
+			}
+		}
+		if autoInc > 1 {
+			errs = append(errs, prefix+"more than one auto_increment column")
+		}
+	}
+
+	return errs
+}
+
+/**
+* Column is the first column of the primary key or an index
+ */
+func (yt *yamlTable) isKeyColumn(name string) bool {
+	if len(yt.PrimaryKey) > 0 && yt.PrimaryKey[0] == name {
+		return true
+	}
+	for _, idx := range yt.Indexes {
+		if len(idx.Columns) > 0 && idx.Columns[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* Table definition of the yaml table
+ */
+func (yt *yamlTable) tableDef() *tableDef {
+	td := &tableDef{Name: yt.Name, Options: yt.Options, Comment: yt.Comment}
+	for _, col := range yt.Columns {
+		td.Columns = append(td.Columns, &columnDef{
+			Name:          col.Name,
+			Type:          col.Type,
+			Charset:       col.Charset,
+			Collate:       col.Collate,
+			NotNull:       col.NotNull || inStringSlice(col.Name, yt.PrimaryKey),
+			AutoIncrement: col.AutoIncrement,
+			Default:       col.Default,
+			OnUpdate:      col.OnUpdate,
+			Comment:       col.Comment,
+		})
+	}
+
+	if len(yt.PrimaryKey) > 0 {
+		td.Indexes = append(td.Indexes, &indexDef{Kind: "PRIMARY", Columns: yt.PrimaryKey})
+	}
+	for _, idx := range yt.Indexes {
+		kind := "KEY"
+		if idx.Unique {
+			kind = "UNIQUE"
+		} else if "" != idx.Type {
+			kind = strings.ToUpper(idx.Type)
+		}
+		td.Indexes = append(td.Indexes, &indexDef{Name: idx.Name, Kind: kind, Columns: idx.Columns})
+	}
+
+	for i, fk := range yt.ForeignKeys {
+		name := fk.Name
+		if "" == name { // name it as mysql does
+			name = fmt.Sprintf("%s_ibfk_%d", yt.Name, i+1)
+		}
+		td.Foreign = append(td.Foreign, &foreignKeyDef{Name: name, Columns: fk.Columns, RefTable: fk.RefTable,
+			RefColumns: fk.RefColumns, OnDelete: fk.OnDelete, OnUpdate: fk.OnUpdate})
+	}
+	return td
+}
+
+/**
+* Yaml table of the table definition
+ */
+func yamlTableFromDef(td *tableDef) *yamlTable {
+	yt := &yamlTable{Name: td.Name, Options: td.Options, Comment: td.Comment}
+	for _, col := range td.Columns {
+		yt.Columns = append(yt.Columns, &yamlColumn{
+			Name:          col.Name,
+			Type:          col.Type,
+			NotNull:       col.NotNull,
+			AutoIncrement: col.AutoIncrement,
+			Default:       col.Default,
+			OnUpdate:      col.OnUpdate,
+			Charset:       col.Charset,
+			Collate:       col.Collate,
+			Comment:       col.Comment,
+		})
+	}
+
+	for _, idx := range td.Indexes {
+		switch idx.Kind {
+		case "PRIMARY":
+			yt.PrimaryKey = idx.Columns
+		case "UNIQUE":
+			yt.Indexes = append(yt.Indexes, &yamlIndex{Name: idx.Name, Columns: idx.Columns, Unique: true})
+		case "FULLTEXT", "SPATIAL":
+			yt.Indexes = append(yt.Indexes, &yamlIndex{Name: idx.Name, Columns: idx.Columns, Type: idx.Kind})
+		default:
+			yt.Indexes = append(yt.Indexes, &yamlIndex{Name: idx.Name, Columns: idx.Columns})
+		}
+	}
+
+	for _, fk := range td.Foreign {
+		yt.ForeignKeys = append(yt.ForeignKeys, &yamlForeignKey{Name: fk.Name, Columns: fk.Columns, RefTable: fk.RefTable,
+			RefColumns: fk.RefColumns, OnDelete: fk.OnDelete, OnUpdate: fk.OnUpdate})
+	}
+	return yt
+}
+
+/**
+* Yaml / json of the tables, by the extension of the file name
+ */
+func marshalYamlSchema(fileName string, tables map[string]*MySchema) ([]byte, error) {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schema := &yamlSchema{}
+	for _, name := range names {
+		schema.Tables = append(schema.Tables, yamlTableFromDef(tableDefFromSchema(name, tables[name])))
+	}
+
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		data, err := json.MarshalIndent(schema, "", "  ")
+		return append(data, '\n'), err
+	}
+	return yaml.Marshal(schema)
+}
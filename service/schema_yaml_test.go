@@ -0,0 +1,28 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYamlSchemaUnknownKey(t *testing.T) {
+	globalSet = &GlobalSet{}
+	tests := []struct {
+		path    string
+		content string
+	}{
+		{"schema.yaml", "tables:\n  - name: a\n    columns:\n      - name: id\n        type: int\n        nulable: true\n"},
+		{"schema.json", `{"tables": [{"name": "a", "columns": [{"name": "id", "type": "int", "nulable": true}]}]}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := yamlSchemaSQL(tt.path, tt.content); nil == err || !strings.Contains(err.Error(), "nulable") {
+			t.Errorf("yamlSchemaSQL(%s) error = %v, want unknown key nulable", tt.path, err)
+		}
+
+		fixed := strings.Replace(tt.content, "nulable", "not_null", 1)
+		if sql, err := yamlSchemaSQL(tt.path, fixed); nil != err || !strings.Contains(sql, "`id` int NOT NULL") {
+			t.Errorf("yamlSchemaSQL(%s) = %q, %v", tt.path, sql, err)
+		}
+	}
+}
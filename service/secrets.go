@@ -0,0 +1,191 @@
+// Environment variable, secret file and credential command references of the config
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"struct_sync/logger"
+	"time"
+)
+
+const secretFilePrefix = "file://"
+
+// Max run time of the credential command
+const credentialCmdTimeout = 30 * time.Second
+
+// ${NAME} or ${NAME:-default}
+var envRefRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Placeholders of LogFileName, not environment variables
+var keptEnvRefs = []string{"date", "time"}
+
+/**
+* Resolve the references in the string config values: ${NAME} and ${NAME:-default} by the environment variables,
+* file://path by the content of the file (relative to baseDir, the config dir).
+* Then the empty Pswd of the db sets by CredentialCmd. The resolved secrets are redacted in the log
+ */
+func ResolveSecrets(set *GlobalSet, baseDir string) error {
+	dbSets := append([]*DBSet{set.SrcDbDsn, set.ShadowDbDsn}, set.DestDbList...)
+	referenced := make(map[*DBSet]bool, len(dbSets)) // password of a reference, not written in the config
+	for _, dbSet := range dbSets {
+		if nil != dbSet {
+			referenced[dbSet] = strings.HasPrefix(dbSet.Pswd, secretFilePrefix) || envRefRegexp.MatchString(dbSet.Pswd)
+		}
+	}
+
+	if err := resolveValue(reflect.ValueOf(set).Elem(), "", baseDir); nil != err {
+		return err
+	}
+
+	for _, dbSet := range dbSets {
+		if nil == dbSet {
+			continue
+		}
+		if "" == dbSet.Pswd && "" != set.CredentialCmd {
+			pswd, err := runCredentialCmd(set.CredentialCmd, dbSet)
+			if nil != err {
+				return err
+			}
+			dbSet.Pswd = pswd
+			referenced[dbSet] = true
+		}
+		if referenced[dbSet] && "" != dbSet.Pswd && len(dbSet.Pswd) < logger.MinSecretLen {
+			return fmt.Errorf("password of %s@%s:%s is shorter than %d characters, it can't be redacted in the log",
+				dbSet.User, dbSet.Host, dbSet.Port, logger.MinSecretLen)
+		}
+		logger.AddSecret(dbSet.Pswd)
+	}
+	return nil
+}
+
+/**
+* Resolve the exported string fields of the value recursively, key is the config path for the errors, ex: DestDbList.0.Pswd
+ */
+func resolveValue(v reflect.Value, key, baseDir string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return resolveValue(v.Elem(), key, baseDir)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if "" != field.PkgPath { // unexported
+				continue
+			}
+			if err := resolveValue(v.Field(i), joinKey(key, field.Name), baseDir); nil != err {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i), joinKey(key, strconv.Itoa(i)), baseDir); nil != err {
+				return err
+			}
+		}
+	case reflect.String:
+		resolved, err := resolveString(v.String(), baseDir)
+		if nil != err {
+			return fmt.Errorf("key %s: %s", key, err.Error())
+		}
+		v.SetString(resolved)
+	}
+	return nil
+}
+
+func joinKey(key, name string) string {
+	if "" == key {
+		return name
+	}
+	return key + "." + name
+}
+
+/**
+* Value of a config string: the content of a file:// reference, else the environment variables expanded
+ */
+func resolveString(value, baseDir string) (string, error) {
+	if strings.HasPrefix(value, secretFilePrefix) {
+		file := strings.TrimPrefix(value, secretFilePrefix)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(baseDir, file)
+		}
+		content, err := ioutil.ReadFile(file)
+		if nil != err {
+			return "", fmt.Errorf("read secret file failed: %s", err.Error())
+		}
+		secret := strings.TrimRight(string(content), "\r\n")
+		if "" != secret && len(secret) < logger.MinSecretLen {
+			return "", fmt.Errorf("secret file content is shorter than %d characters, it can't be redacted in the log", logger.MinSecretLen)
+		}
+		logger.AddSecret(secret)
+		return secret, nil
+	}
+
+	var err error
+	resolved := envRefRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		match := envRefRegexp.FindStringSubmatch(ref)
+		name := match[1]
+		if inStringSlice(name, keptEnvRefs) {
+			return ref
+		}
+		if env, has := os.LookupEnv(name); has {
+			return env
+		}
+		if strings.Contains(ref, ":-") {
+			return match[2]
+		}
+		if nil == err {
+			err = fmt.Errorf("environment variable %s not set", name)
+		}
+		return ref
+	})
+	return resolved, err
+}
+
+/**
+* Password of the db set printed by the credential command, the db set is passed by the STRUCTSYNC_* environment variables
+ */
+func runCredentialCmd(command string, dbSet *DBSet) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialCmdTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if "windows" == runtime.GOOS {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(),
+		"STRUCTSYNC_HOST="+dbSet.Host,
+		"STRUCTSYNC_PORT="+dbSet.Port,
+		"STRUCTSYNC_USER="+dbSet.User,
+		"STRUCTSYNC_DB="+dbSet.DbName)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if nil != err {
+		msg := strings.TrimSpace(stderr.String())
+		if "" == msg {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("credential command of %s@%s:%s failed: %s", dbSet.User, dbSet.Host, dbSet.Port, msg)
+	}
+
+	pswd := strings.TrimRight(string(out), "\r\n")
+	if "" == pswd {
+		return "", fmt.Errorf("credential command of %s@%s:%s printed no password", dbSet.User, dbSet.Host, dbSet.Port)
+	}
+	return pswd, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecretsShortPassword(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "short"), []byte("abc\n"), 0600)
+	t.Setenv("SS_TEST_PSWD", "xyz")
+
+	for _, pswd := range []string{"${SS_TEST_PSWD}", "file://short"} {
+		set := &GlobalSet{SrcDbDsn: &DBSet{Host: "h", Pswd: pswd}}
+		if err := ResolveSecrets(set, dir); nil == err || !strings.Contains(err.Error(), "can't be redacted") {
+			t.Errorf("ResolveSecrets(%s) error = %v, want short password error", pswd, err)
+		}
+	}
+
+	// Written in the config, or empty
+	for _, pswd := range []string{"abc", "${SS_TEST_EMPTY:-}"} {
+		set := &GlobalSet{SrcDbDsn: &DBSet{Host: "h", Pswd: pswd}}
+		if err := ResolveSecrets(set, dir); nil != err {
+			t.Errorf("ResolveSecrets(%s) error: %v", pswd, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Shadow database dry run
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"struct_sync/model"
+)
+
+// max length of mysql database name
+const maxDbNameLen = 64
+
+/**
+* Unique name of the shadow database, ex: _ss_shadow_20190101120000_9f2c4a1b_shop.
+* The random part keeps the concurrent runs on one server apart, the dest db name is truncated to fit 64 characters
+ */
+func shadowDbName(dbName string) (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); nil != err {
+		return "", err
+	}
+	prefix := "_ss_shadow_" + getSyncKey() + "_" + hex.EncodeToString(random) + "_"
+	if runes := []rune(dbName); len(prefix)+len(runes) > maxDbNameLen {
+		dbName = string(runes[:maxDbNameLen-len(prefix)])
+	}
+	return prefix + dbName, nil
+}
+
+// empty temporary database on the shadow server
+type shadowDatabase struct {
+	set    DBSet
+	name   string
+	server *model.MysqlDb
+}
+
+/**
+* Create a shadow database on ShadowDbDsn (default the dest server) with the charset of the dest db, drop it after use
+ */
+func (sc *SchemaSync) createShadowDatabase(from string) (*shadowDatabase, error) {
+	shadow := &shadowDatabase{set: *sc.DbSet}
+	if nil != globalSet.ShadowDbDsn {
+		shadow.set = *globalSet.ShadowDbDsn
+	}
+	if "" == shadow.set.timeout {
+		shadow.set.timeout = sc.DbSet.timeout
+	}
+
+	var err error
+	if shadow.name, err = shadowDbName(sc.DbSet.DbName); nil != err {
+		return nil, err
+	}
+	if shadow.server, err = model.NewMysqlDb(shadow.set.dsn("")); nil != err {
+		return nil, fmt.Errorf("connect shadow server: %s", err.Error())
+	}
+
+	createSQL := fmt.Sprintf("CREATE DATABASE `%s`", shadow.name)
+	_, rows, err := sc.DestDb.SqlQuery(fmt.Sprintf("SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME"+
+		" FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = %s", quoteString(sc.DbSet.DbName)))
+	if nil == err && len(rows) > 0 {
+		createSQL += fmt.Sprintf(" DEFAULT CHARACTER SET %s COLLATE %s",
+			rows[0]["DEFAULT_CHARACTER_SET_NAME"], rows[0]["DEFAULT_COLLATION_NAME"])
+	}
+	if _, err = shadow.server.SqlExec(createSQL); nil != err {
+		shadow.server.Close()
+		return nil, fmt.Errorf("create shadow database: %s", err.Error())
+	}
+	sc.addInfoLog(from, "Create shadow database "+shadow.name)
+	return shadow, nil
+}
+
+/**
+* Connect the shadow database
+ */
+func (shadow *shadowDatabase) connect(foreignKeyChecksOff bool) (*model.MysqlDb, error) {
+	dsn := shadow.set.dsn(shadow.name)
+	if foreignKeyChecksOff {
+		dsn += "&foreign_key_checks=0"
+	}
+	db, err := model.NewMysqlDb(dsn)
+	if nil != err {
+		return nil, fmt.Errorf("connect shadow database: %s", err.Error())
+	}
+	return db, nil
+}
+
+/**
+* Drop the shadow database and close the connection
+ */
+func (sc *SchemaSync) dropShadowDatabase(from string, shadow *shadowDatabase) {
+	if _, err := shadow.server.SqlExec(fmt.Sprintf("DROP DATABASE `%s`", shadow.name)); nil != err {
+		sc.addErrorLog(from, fmt.Sprint("Drop shadow database ", shadow.name, " failed: ", err.Error()))
+	}
+	shadow.server.Close()
+}
+
+/**
+* Apply the adjust sql to a temporary copy of the dest db and check the result matches the source
+ */
+func (sc *SchemaSync) shadowDryRun(plan []*TableAlterData) error {
+	shadow, err := sc.createShadowDatabase("shadowDryRun")
+	if nil != err {
+		return fmt.Errorf("shadow dry run failed, %s", err.Error())
+	}
+	defer sc.dropShadowDatabase("shadowDryRun", shadow)
+
+	// Recreate the dest tables, in any order
+	copyDb, err := shadow.connect(true)
+	if nil != err {
+		return fmt.Errorf("shadow dry run failed, %s", err.Error())
+	}
+	for _, table := range sc.DestDb.GetTableNames() {
+		schema, err := sc.DestDb.GetTableSchema(table)
+		if nil == err {
+			_, err = copyDb.SqlExec(schema)
+		}
+		if nil != err {
+			copyDb.Close()
+			return fmt.Errorf("shadow dry run failed, copy dest table `%s`: %s", table, err.Error())
+		}
+	}
+	copyDb.Close()
+
+	shadowDb, err := shadow.connect(globalSet.ForeignKeyChecksOff)
+	if nil != err {
+		return fmt.Errorf("shadow dry run failed, %s", err.Error())
+	}
+	defer shadowDb.Close()
+
+	// Apply adjust sql, same order as the dest db
+	for _, sd := range plan {
+		sql := strings.TrimRight(strings.TrimSpace(sd.SQL), ";")
+		ctx, cancel := sc.stmtContext()
+		_, err = shadowDb.ExecContext(ctx, sql)
+		cancel()
+		if nil != err {
+			return fmt.Errorf("shadow dry run failed, table `%s`: %s", sd.Table, err.Error())
+		}
+	}
+
+	// Check the changed tables are the same as the source, the others are copies of the dest
+	var diffs []string
+	checked := make(map[string]bool)
+	for _, sd := range plan {
+		if checked[sd.Table] { // more changes of a table in a foreign key cycle
+			continue
+		}
+		checked[sd.Table] = true
+
+		schema, _ := shadowDb.GetTableSchema(sd.Table)
+		if source := gTableList[sd.Table]; nil != source {
+			for _, diff := range compareSchema(source, ParseSchema(schema), globalSet.DropUnecessary) {
+				diffs = append(diffs, fmt.Sprintf("`%s` %s", sd.Table, diff))
+			}
+		} else if "" != schema {
+			diffs = append(diffs, fmt.Sprintf("`%s` table unnecessary", sd.Table))
+		}
+	}
+
+	for _, diff := range diffs {
+		sc.addWarnLog("shadowDryRun", "[SHADOW.DIFF] "+diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("shadow dry run failed, %d difference(s) left, first: %s", len(diffs), diffs[0])
+	}
+
+	sc.addInfoLog("shadowDryRun", "Shadow dry run passed")
+	return nil
+}
@@ -0,0 +1,179 @@
+// Adjust sql output files of the dest db
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	OutputModeOverwrite = "overwrite" // rewrite the files of the day
+	OutputModeAppend    = "append"    // append to the files of the day
+	OutputModeVersioned = "versioned" // new directory per run, <date>/<time>
+)
+
+// Supported output modes
+var OutputModes = []string{OutputModeOverwrite, OutputModeAppend, OutputModeVersioned}
+
+// adjust sql output of one dest db: one annotated file, one file per table, or stdout
+type sqlOutput struct {
+	dbSet   *DBSet
+	dir     string          // one file per table in dir when OutputPerTable
+	written map[string]bool // files of dir written in this run, appended to after the first write
+	file    io.StringWriter // the file of the dest db
+	closer  io.Closer
+	stream  *strings.Builder // streamed to stdout on close
+}
+
+/**
+* Run directory of the output, <OutputDir>/<date>, and /<time> for versioned mode
+ */
+func outputRunDir(outputDir, mode string, now time.Time) (string, error) {
+	dir := filepath.Join(outputDir, now.Format("2006-01-02"))
+	if OutputModeVersioned == mode {
+		base := filepath.Join(dir, now.Format("150405"))
+		dir = base
+		for i := 2; ; i++ { // more runs in one second
+			if _, err := os.Stat(dir); os.IsNotExist(err) {
+				break
+			}
+			dir = fmt.Sprintf("%s_%d", base, i)
+		}
+	}
+	return dir, os.MkdirAll(dir, os.ModeDir|os.ModePerm)
+}
+
+/**
+* Open the output of the dest db by OutputMode and OutputPerTable
+ */
+func newSQLOutput(dbSet *DBSet) (*sqlOutput, error) {
+	out := &sqlOutput{dbSet: dbSet}
+	if stdioPath == globalSet.OutputDir {
+		out.stream = &strings.Builder{}
+		out.file = out.stream
+		return out, nil
+	}
+
+	if globalSet.OutputPerTable {
+		out.dir = filepath.Join(globalSet.OutputDir, dbSet.String())
+		out.written = make(map[string]bool)
+		if err := os.MkdirAll(out.dir, os.ModePerm); nil != err {
+			return nil, err
+		}
+		if OutputModeOverwrite == globalSet.OutputMode { // the tables of the last run may be same now
+			oldFiles, _ := filepath.Glob(filepath.Join(out.dir, "*.sql"))
+			for _, file := range oldFiles {
+				if err := os.Remove(file); nil != err {
+					return nil, err
+				}
+			}
+		}
+		return out, nil
+	}
+
+	file, err := openOutputFile(filepath.Join(globalSet.OutputDir, dbSet.String()+".sql"))
+	if nil != err {
+		return nil, err
+	}
+	out.file = file
+	out.closer = file
+	return out, nil
+}
+
+/**
+* Open the output file, truncated unless OutputMode is append
+ */
+func openOutputFile(fileName string) (*os.File, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if OutputModeAppend == globalSet.OutputMode {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	return os.OpenFile(fileName, flag, 0644)
+}
+
+/**
+* Before the table changes
+ */
+func (out *sqlOutput) beginTables(plan []*TableAlterData) {
+	if "" == out.dir && globalSet.ForeignKeyChecksOff && len(plan) > 0 {
+		out.file.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	}
+}
+
+/**
+* After the table changes
+ */
+func (out *sqlOutput) endTables(plan []*TableAlterData) {
+	if "" == out.dir && globalSet.ForeignKeyChecksOff && len(plan) > 0 {
+		out.file.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+}
+
+/**
+* Table change with the header of the table, type and relation tables
+ */
+func (out *sqlOutput) writeTable(sd *TableAlterData) error {
+	if "" == out.dir {
+		_, err := out.file.WriteString(sd.String())
+		return err
+	}
+
+	content := sd.String()
+	if globalSet.ForeignKeyChecksOff {
+		content = "SET FOREIGN_KEY_CHECKS=0;\n" + content + "SET FOREIGN_KEY_CHECKS=1;\n"
+	}
+	return out.writeFile(sd.Table+".sql", content)
+}
+
+/**
+* View, routine or trigger change with the header
+ */
+func (out *sqlOutput) writeObject(oa *ObjectAlterData) error {
+	content := fmt.Sprintf("\n-- %s : %s\n%s", oa.Object, oa.Type, oa.fileSQL())
+	if "" == out.dir {
+		_, err := out.file.WriteString(content)
+		return err
+	}
+	return out.writeFile(oa.Object.Name+"."+strings.ToLower(oa.Object.Type)+".sql", content)
+}
+
+/**
+* Write to a file of dir, a table in a foreign key cycle has more changes: only the first one truncates the file
+ */
+func (out *sqlOutput) writeFile(name, content string) error {
+	fileName := filepath.Join(out.dir, name)
+	var file *os.File
+	var err error
+	if out.written[fileName] {
+		file, err = os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	} else {
+		file, err = openOutputFile(fileName)
+	}
+	if nil != err {
+		return err
+	}
+	out.written[fileName] = true
+	defer file.Close()
+	_, err = file.WriteString(content)
+	return err
+}
+
+/**
+* Close the file, or write the stream to stdout
+ */
+func (out *sqlOutput) Close() error {
+	if nil != out.stream {
+		if out.stream.Len() == 0 {
+			return nil
+		}
+		return writeStdout(fmt.Sprintf("-- %s\n%s", out.dbSet, out.stream.String()))
+	}
+	if nil != out.closer {
+		return out.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPerTableOutputForeignKeyCycle(t *testing.T) {
+	for _, mode := range OutputModes {
+		globalSet = &GlobalSet{OutputDir: t.TempDir(), OutputMode: mode, OutputPerTable: true}
+		dbSet := &DBSet{DbName: "shop", Host: "127.0.0.1", Port: "3306"}
+
+		// The second run of overwrite (and append) mode
+		for run := 0; run < 2; run++ {
+			out, err := newSQLOutput(dbSet)
+			if nil != err {
+				t.Fatalf("newSQLOutput() error: %v", err)
+			}
+			for _, sd := range cyclePlan(alterTypeCreate) {
+				if err := out.writeTable(sd); nil != err {
+					t.Fatalf("writeTable() error: %v", err)
+				}
+			}
+			out.Close()
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(globalSet.OutputDir, dbSet.String(), "a.sql"))
+		if nil != err {
+			t.Fatalf("read a.sql: %v", err)
+		}
+		want := 1
+		if OutputModeAppend == mode {
+			want = 2
+		}
+		content := string(data)
+		if strings.Count(content, "CREATE TABLE `a`") != want || strings.Count(content, "ADD CONSTRAINT `fk_a_b`") != want {
+			t.Errorf("%s mode a.sql = %q, want the create and the foreign keys %d times", mode, content, want)
+		}
+	}
+}
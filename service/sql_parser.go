@@ -0,0 +1,808 @@
+// Schema file parser
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"struct_sync/logger"
+	"struct_sync/model"
+)
+
+var createTableReg = regexp.MustCompile(`(?is)^CREATE\s+(TEMPORARY\s+)?TABLE\s+(IF\s+NOT\s+EXISTS\s+)?`)
+
+// mysqldump and mysqlpump statements
+var useDbReg = regexp.MustCompile(`(?is)^USE\s+`)
+var createDbReg = regexp.MustCompile(`(?is)^CREATE\s+(DATABASE|SCHEMA)\s+(IF\s+NOT\s+EXISTS\s+)?`)
+var dropObjectReg = regexp.MustCompile(`(?is)^DROP\s+(TEMPORARY\s+)?(TABLE|VIEW|PROCEDURE|FUNCTION|TRIGGER)\s+(IF\s+EXISTS\s+)?`)
+var alterTableReg = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+`)
+var dumpSkipReg = regexp.MustCompile(`(?is)^(SET|LOCK|UNLOCK|INSERT|REPLACE|START|COMMIT|FLUSH)\b`)
+var dumpKeysReg = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+\S+\s+(DISABLE|ENABLE)\s+KEYS$`)
+
+var tableOptionSpaceReg = regexp.MustCompile(`\s*=\s*`)
+var tableCharsetReg = regexp.MustCompile(`(?i)\b(DEFAULT\s+)?(CHARACTER\s+SET|CHARSET)(\s+|=)`)
+var tableCollateReg = regexp.MustCompile(`(?i)\b(DEFAULT\s+)?COLLATE(\s+|=)`)
+var tableOptionNameReg = regexp.MustCompile(`\b([A-Za-z_]+)=`)
+
+var indexNameReg = regexp.MustCompile(`(?i)^((?:PRIMARY|UNIQUE|FULLTEXT|SPATIAL)?\s*(?:KEY|INDEX)|CONSTRAINT)\s+([A-Za-z0-9_$]+)`)
+var referencesReg = regexp.MustCompile(`(?i)\bREFERENCES\s+([A-Za-z0-9_$]+)`)
+
+// first word of index definition
+var indexKeywords = []string{"PRIMARY", "KEY", "INDEX", "UNIQUE", "FULLTEXT", "SPATIAL", "CONSTRAINT", "FOREIGN", "CHECK"}
+
+/**
+* Read schema file, parser the create table statements
+ */
+func parseSchemaFile(fileName string) (*schemaSource, error) {
+	data, err := readInput(fileName)
+	if nil != err {
+		return nil, err
+	}
+
+	return loadSchemaFiles([]schemaFile{{Path: fileName, Content: string(data)}})
+}
+
+/**
+* Parser the create table, view, routine and trigger statements, other statements are ignored.
+* mysqldump / mysqlpump output: DROP statements remove the earlier definition,
+* ALTER TABLE ADD index is merged to the table, only the statements of the picked database are used
+ */
+func parseSchemaStatements(stmts []string) (map[string]*MySchema, []*DbObject, error) {
+	// Database of each statement, the qualifier of the name or the last USE
+	var entries []schemaStatement
+	dbs := make(map[string]bool)
+	curDb := ""
+	for _, stmt := range stmts {
+		if loc := useDbReg.FindStringIndex(stmt); nil != loc {
+			curDb, _ = readIdentifier(strings.TrimSpace(stmt[loc[1]:]))
+			dbs[curDb] = true
+			continue
+		}
+		if loc := createDbReg.FindStringIndex(stmt); nil != loc {
+			name, _ := readIdentifier(strings.TrimSpace(stmt[loc[1]:]))
+			dbs[name] = true
+			continue
+		}
+
+		dbName, _ := statementName(stmt)
+		if "" != dbName {
+			dbs[dbName] = true
+		} else {
+			dbName = curDb
+		}
+		entries = append(entries, schemaStatement{db: dbName, sql: stmt})
+	}
+
+	target, err := schemaDatabase(dbs)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	creates := make(map[string]string) // table -> create statement
+	addDefs := make(map[string][]string)
+	var objects []*DbObject
+	for _, entry := range entries {
+		stmt := entry.sql
+		if "" != entry.db && entry.db != target {
+			continue
+		}
+
+		if obj := parseObjectStatement(stmt); nil != obj {
+			if obj.Type == objectTypeView { // replace the placeholder table of mysqldump
+				delete(creates, obj.Name)
+			}
+			objects = append(objects, obj)
+			continue
+		}
+
+		_, name := statementName(stmt)
+		switch {
+		case createTableReg.MatchString(stmt):
+			if _, has := creates[name]; has {
+				return nil, nil, fmt.Errorf("table `%s` defined more than once", name)
+			}
+			creates[name] = stmt
+		case dropObjectReg.MatchString(stmt):
+			objType := strings.ToUpper(dropObjectReg.FindStringSubmatch(stmt)[2])
+			if objType == objectTypeTable {
+				delete(creates, name)
+				delete(addDefs, name)
+			} else {
+				objects = removeObject(objects, objType, name)
+			}
+		case dumpKeysReg.MatchString(stmt):
+			// ALTER TABLE ... DISABLE KEYS around the data of mysqldump
+		case alterTableReg.MatchString(stmt):
+			defs, ok := alterAddDefinitions(stmt)
+			if !ok {
+				logger.Warn("Ignore statement, not add index:", firstLine(stmt))
+			}
+			addDefs[name] = append(addDefs[name], defs...)
+		case dumpSkipReg.MatchString(stmt):
+			// session settings and data of mysqldump
+		default:
+			logger.Warn("Ignore statement, not create table:", firstLine(stmt))
+		}
+	}
+
+	tables := make(map[string]*MySchema, len(creates))
+	for _, stmt := range creates {
+		table, schema, err := normalizeCreateTable(stmt)
+		if nil != err {
+			return nil, nil, err
+		}
+		if defs := addDefs[table]; len(defs) > 0 {
+			end := strings.LastIndex(schema, "\n)")
+			schema = schema[:end] + ",\n  " + strings.Join(defs, ",\n  ") + schema[end:]
+		}
+		tables[table] = parseSchemaWithFields(schema)
+	}
+
+	return tables, objects, nil
+}
+
+// statement and the database it belongs to
+type schemaStatement struct {
+	db  string
+	sql string
+}
+
+/**
+* Database and name of the table or object of the statement
+ */
+func statementName(stmt string) (string, string) {
+	for _, reg := range []*regexp.Regexp{createTableReg, objectCreateReg, dropObjectReg, alterTableReg} {
+		if loc := reg.FindStringIndex(stmt); nil != loc {
+			dbName, name, _ := readQualifiedName(strings.TrimSpace(stmt[loc[1]:]))
+			return dbName, name
+		}
+	}
+	return "", ""
+}
+
+/**
+* The database to use when the schema file has more than one, set by InputDbName
+ */
+func schemaDatabase(dbs map[string]bool) (string, error) {
+	if "" != globalSet.InputDbName {
+		if len(dbs) > 0 && !dbs[globalSet.InputDbName] {
+			return "", fmt.Errorf("database `%s` not found in schema file", globalSet.InputDbName)
+		}
+		return globalSet.InputDbName, nil
+	}
+
+	var names []string
+	for name := range dbs {
+		names = append(names, name)
+	}
+	if len(names) > 1 {
+		return "", fmt.Errorf("schema file has databases %s, set InputDbName", strings.Join(sortStrings(names), ", "))
+	}
+	if len(names) == 1 {
+		return names[0], nil
+	}
+	return "", nil
+}
+
+/**
+* Index definitions of ALTER TABLE ADD, false when the statement is not only adding index
+ */
+func alterAddDefinitions(stmt string) ([]string, bool) {
+	loc := alterTableReg.FindStringIndex(stmt)
+	rest := strings.TrimSpace(stmt[loc[1]:])
+	_, _, n := readQualifiedName(rest)
+
+	var defs []string
+	for _, part := range splitOutsideQuotes(rest[n:], ',') {
+		part = collapseSpace(part)
+		if !hasPrefixFold(part, "ADD ") {
+			return nil, false
+		}
+		def := strings.TrimSpace(part[len("ADD "):])
+		word := strings.ToUpper(strings.SplitN(def, " ", 2)[0])
+		if "" == def || !inStringSlice(word, indexKeywords) {
+			return nil, false
+		}
+		defs = append(defs, normalizeDefinition(def))
+	}
+	return defs, len(defs) > 0
+}
+
+/**
+* Remove the object of the type and name
+ */
+func removeObject(objects []*DbObject, objType, name string) []*DbObject {
+	kept := objects[:0]
+	for _, obj := range objects {
+		if obj.Type != objType || obj.Name != name {
+			kept = append(kept, obj)
+		}
+	}
+	return kept
+}
+
+/**
+* Parser the create table sql, the field struct comes from the column definition
+ */
+func parseSchemaWithFields(schema string) *MySchema {
+	mys := ParseSchema(schema)
+	mys.FieldSchemas = make(map[string]*model.FieldSchema, len(mys.Fields))
+	for name, line := range mys.Fields {
+		mys.FieldSchemas[name] = parseFieldSchema(line)
+	}
+	return mys
+}
+
+/**
+* Split sql content to statements, support quote, comment, conditional comment and DELIMITER
+ */
+func splitSQLStatements(content string) []string {
+	var stmts []string
+	var buf strings.Builder
+	var quote byte
+	delimiter := ";"
+	stmtStart := true    // nothing but space after the last delimiter
+	inCondition := false // in /*!NNNNN ... */
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(content) {
+				buf.WriteByte(content[i+1])
+				i += 2
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			i++
+			continue
+		}
+
+		rest := content[i:]
+		switch {
+		case stmtStart && hasPrefixFold(rest, "DELIMITER "):
+			line := rest
+			if end := strings.IndexByte(rest, '\n'); end >= 0 {
+				line = rest[:end]
+			}
+			delimiter = strings.TrimSpace(line[len("DELIMITER "):])
+			buf.Reset()
+			i += len(line)
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			stmtStart = false
+			buf.WriteByte(c)
+			i++
+		case c == '#' || rest == "--" || strings.HasPrefix(rest, "-- ") ||
+			strings.HasPrefix(rest, "--\t") || strings.HasPrefix(rest, "--\n") || strings.HasPrefix(rest, "--\r"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case inCondition && strings.HasPrefix(rest, "*/"): // end of conditional comment
+			inCondition = false
+			buf.WriteByte(' ')
+			i += 2
+		case strings.HasPrefix(rest, "/*!") || strings.HasPrefix(rest, "/*M!"):
+			// mysqldump conditional comment /*!40101 ... */, use the content
+			i += strings.IndexByte(rest, '!') + 1
+			for i < len(content) && content[i] >= '0' && content[i] <= '9' {
+				i++
+			}
+			inCondition = true
+			buf.WriteByte(' ')
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			i += end
+		case strings.HasPrefix(rest, delimiter):
+			if stmt := strings.TrimSpace(buf.String()); "" != stmt {
+				stmts = append(stmts, stmt)
+			}
+			buf.Reset()
+			stmtStart = true
+			i += len(delimiter)
+		default:
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				stmtStart = false
+			}
+			buf.WriteByte(c)
+			i++
+		}
+	}
+
+	if stmt := strings.TrimSpace(buf.String()); "" != stmt { // Maybe miss ';'
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+/**
+* Format create table statement as SHOW CREATE TABLE output, one definition per line
+ */
+func normalizeCreateTable(stmt string) (string, string, error) {
+	loc := createTableReg.FindStringIndex(stmt)
+	if nil == loc {
+		return "", "", fmt.Errorf("not create table: %s", firstLine(stmt))
+	}
+
+	rest := strings.TrimSpace(stmt[loc[1]:])
+	_, table, n := readQualifiedName(rest)
+	rest = strings.TrimSpace(rest[n:])
+	if "" == table || !strings.HasPrefix(rest, "(") {
+		return "", "", fmt.Errorf("unsupported create table: %s", firstLine(stmt))
+	}
+
+	end := matchParen(rest)
+	if end < 0 {
+		return "", "", fmt.Errorf("table `%s` definition not closed", table)
+	}
+
+	var defs []string
+	fkNum := 0
+	for _, def := range splitOutsideQuotes(rest[1:end], ',') {
+		def = collapseSpace(def)
+		if "" == def {
+			continue
+		}
+		if hasPrefixFold(def, "FOREIGN KEY") { // name it as mysql does
+			fkNum++
+			def = fmt.Sprintf("CONSTRAINT `%s_ibfk_%d` %s", table, fkNum, def)
+		}
+		defs = append(defs, normalizeDefinition(def))
+	}
+	if len(defs) == 0 {
+		return "", "", fmt.Errorf("table `%s` has no column", table)
+	}
+
+	schema := fmt.Sprintf("CREATE TABLE `%s` (\n  %s\n)", table, strings.Join(defs, ",\n  "))
+	if options := normalizeTableOptions(rest[end+1:]); "" != options {
+		schema += " " + options
+	}
+	return table, schema, nil
+}
+
+/**
+* Format one column or index definition
+ */
+func normalizeDefinition(def string) string {
+	word := strings.ToUpper(strings.SplitN(def, " ", 2)[0])
+	if '`' != def[0] && !inStringSlice(word, indexKeywords) { // column name without quote
+		name, n := readIdentifier(def)
+		def = "`" + name + "`" + def[n:]
+	}
+
+	if '`' == def[0] { // column, lower the type name as mysql does
+		end := strings.Index(def[1:], "`") + 2
+		tokens := splitOutsideQuotes(strings.TrimSpace(def[end:]), ' ')
+		for i, token := range tokens {
+			if i > 0 && !inStringSlice(strings.ToLower(token), []string{"unsigned", "zerofill"}) {
+				break
+			}
+			if p := strings.Index(token, "("); p > 0 {
+				tokens[i] = strings.ToLower(token[:p]) + token[p:]
+			} else {
+				tokens[i] = strings.ToLower(token)
+			}
+		}
+		return def[:end] + " " + strings.Join(tokens, " ")
+	}
+
+	if "CHECK" != word {
+		def = quoteIndexIdentifiers(def)
+	}
+
+	upper := strings.ToUpper(def)
+	for _, kw := range [][2]string{
+		{"UNIQUE INDEX ", "UNIQUE KEY "},
+		{"FULLTEXT INDEX ", "FULLTEXT KEY "},
+		{"SPATIAL INDEX ", "SPATIAL KEY "},
+		{"INDEX ", "KEY "},
+		{"UNIQUE KEY ", "UNIQUE KEY "},
+		{"UNIQUE ", "UNIQUE KEY "},
+		{"FULLTEXT KEY ", "FULLTEXT KEY "},
+		{"SPATIAL KEY ", "SPATIAL KEY "},
+		{"PRIMARY KEY ", "PRIMARY KEY "},
+		{"KEY ", "KEY "},
+		{"CONSTRAINT ", "CONSTRAINT "},
+	} {
+		if strings.HasPrefix(upper, kw[0]) {
+			return kw[1] + def[len(kw[0]):]
+		}
+	}
+	return def
+}
+
+/**
+* Quote the bare index name, table and column names in index definition, upper the keywords
+ */
+func quoteIndexIdentifiers(def string) string {
+	def = mapOutsideQuotes(def, func(s string) string {
+		s = indexNameReg.ReplaceAllStringFunc(s, func(m string) string {
+			sub := indexNameReg.FindStringSubmatch(m)
+			if inStringSlice(strings.ToUpper(sub[2]), []string{"FOREIGN", "CHECK", "USING", "KEY", "INDEX"}) {
+				return m
+			}
+			return sub[1] + " `" + sub[2] + "`"
+		})
+		return referencesReg.ReplaceAllString(s, "REFERENCES `$1`")
+	})
+
+	// column list
+	var result strings.Builder
+	for rest := def; "" != rest; {
+		start := strings.IndexByte(rest, '(')
+		if start < 0 || strings.Count(rest[:start], "`")%2 == 1 || strings.Count(rest[:start], "'")%2 == 1 {
+			result.WriteString(rest)
+			break
+		}
+		end := matchParen(rest[start:])
+		if end < 0 {
+			result.WriteString(rest)
+			break
+		}
+
+		var cols []string
+		for _, col := range splitOutsideQuotes(rest[start+1:start+end], ',') {
+			if name, n := readIdentifier(col); n > 0 && '`' != col[0] && '(' != col[0] {
+				col = "`" + name + "`" + col[n:]
+			}
+			cols = append(cols, col)
+		}
+		result.WriteString(strings.TrimRight(rest[:start], " ") + " (" + strings.Join(cols, ",") + ")")
+		rest = rest[start+end+1:]
+	}
+
+	return mapOutsideQuotes(result.String(), strings.ToUpper)
+}
+
+/**
+* Format table options as key=value, ex: ENGINE=InnoDB DEFAULT CHARSET=utf8
+ */
+func normalizeTableOptions(options string) string {
+	options = collapseSpace(options)
+	return mapOutsideQuotes(options, func(s string) string {
+		s = tableCharsetReg.ReplaceAllString(s, "DEFAULT CHARSET=")
+		s = tableCollateReg.ReplaceAllString(s, "COLLATE=")
+		s = tableOptionSpaceReg.ReplaceAllString(s, "=")
+		return tableOptionNameReg.ReplaceAllStringFunc(s, strings.ToUpper)
+	})
+}
+
+/**
+* Parser field struct from the column definition, same as SHOW COLUMNS
+ */
+func parseFieldSchema(line string) *model.FieldSchema {
+	line = strings.TrimRight(strings.TrimSpace(line), ",")
+	end := strings.Index(line[1:], "`") + 1
+	schema := &model.FieldSchema{FieldName: line[1:end], AllowNull: true}
+
+	tokens := splitOutsideQuotes(strings.TrimSpace(line[end+1:]), ' ')
+	if len(tokens) == 0 {
+		return schema
+	}
+
+	fieldType := tokens[0]
+	i := 1
+	for ; i < len(tokens) && inStringSlice(strings.ToLower(tokens[i]), []string{"unsigned", "zerofill"}); i++ {
+		fieldType += " " + strings.ToLower(tokens[i])
+	}
+	schema.FieldType, schema.FieldLen, _ = model.SplitFieldType(fieldType)
+	schema.ColumnType = fieldType
+
+	for ; i < len(tokens); i++ {
+		switch strings.ToUpper(tokens[i]) {
+		case "NOT":
+			if i+1 < len(tokens) && strings.ToUpper(tokens[i+1]) == "NULL" {
+				schema.AllowNull = false
+				i++
+			}
+		case "PRIMARY":
+			schema.AllowNull = false
+		case "DEFAULT":
+			if i+1 < len(tokens) {
+				schema.DefaultValue = unquoteValue(tokens[i+1])
+				i++
+			}
+		}
+	}
+	return schema
+}
+
+// integer types, the display width has no meaning except zerofill, MySQL 8.0.19+ omits it
+var integerTypes = []string{"tinyint", "smallint", "mediumint", "int", "bigint"}
+
+/**
+* Column type changed, by the normalized types: int unsigned (file) is same as int(10) unsigned (MySQL 5.7)
+ */
+func fieldTypeChanged(source, dest *model.FieldSchema) bool {
+	if "" == source.ColumnType || "" == dest.ColumnType {
+		return source.FieldLen != dest.FieldLen || source.FieldType != dest.FieldType
+	}
+	return normalizeColumnType(source.ColumnType) != normalizeColumnType(dest.ColumnType)
+}
+
+/**
+* Normalized column type: lower name, aliases resolved, no display width of the integer types except tinyint(1) and zerofill,
+* ex: INTEGER(11) UNSIGNED -> int unsigned, bool -> tinyint(1)
+ */
+func normalizeColumnType(colType string) string {
+	colType = collapseSpace(strings.TrimSpace(colType))
+	end := strings.IndexAny(colType, "( ")
+	if end < 0 {
+		end = len(colType)
+	}
+	name, rest := strings.ToLower(colType[:end]), colType[end:]
+
+	switch name {
+	case "integer":
+		name = "int"
+	case "bool", "boolean":
+		name, rest = "tinyint", "(1)"+rest
+	}
+
+	// Lower the attributes, not the enum / set values
+	if !strings.HasPrefix(rest, "(") {
+		rest = strings.ToLower(rest)
+	} else if p := matchParen(rest); p > 0 {
+		length := rest[:p+1]
+		if "enum" != name && "set" != name { // ex: decimal(10, 2)
+			length = strings.Replace(length, " ", "", -1)
+		}
+		rest = length + strings.ToLower(rest[p+1:])
+	}
+
+	if inStringSlice(name, integerTypes) && strings.HasPrefix(rest, "(") && !strings.Contains(rest, "zerofill") {
+		if p := strings.IndexByte(rest, ')'); p > 0 && !("tinyint" == name && "(1)" == rest[:p+1]) {
+			rest = rest[p+1:]
+		}
+	}
+	return name + rest
+}
+
+/**
+* Unquote sql value, NULL is empty. The backslash escapes are resolved, \% and \_ are kept as mysql does
+ */
+func unquoteValue(value string) string {
+	if strings.ToUpper(value) == "NULL" {
+		return ""
+	}
+	if len(value) < 2 || value[0] != '\'' || value[len(value)-1] != '\'' {
+		return value
+	}
+
+	value = value[1 : len(value)-1]
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if '\'' == c && i+1 < len(value) && '\'' == value[i+1] {
+			i++
+		} else if '\\' == c && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case '0':
+				c = 0
+			case 'Z':
+				c = 0x1a
+			case '%', '_':
+				buf.WriteByte('\\')
+				c = value[i]
+			default:
+				c = value[i]
+			}
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+/**
+* Read a quoted or bare identifier, return the name and the length read
+ */
+func readIdentifier(s string) (string, int) {
+	if strings.HasPrefix(s, "`") {
+		for i := 1; i < len(s); i++ {
+			if s[i] != '`' {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '`' { // escaped quote
+				i++
+				continue
+			}
+			return strings.Replace(s[1:i], "``", "`", -1), i + 1
+		}
+		return "", 0
+	}
+
+	i := 0
+	for i < len(s) && !strings.ContainsRune(" \t\r\n(.,;", rune(s[i])) {
+		i++
+	}
+	return s[:i], i
+}
+
+/**
+* Read identifier with optional database, ex: `db`.`table`, return the database, name and the length read
+ */
+func readQualifiedName(s string) (string, string, int) {
+	name, n := readIdentifier(s)
+	rest := strings.TrimLeft(s[n:], " \t\r\n")
+	if !strings.HasPrefix(rest, ".") {
+		return "", name, n
+	}
+
+	rest = rest[1:]
+	skip := len(rest) - len(strings.TrimLeft(rest, " \t\r\n"))
+	name2, n2 := readIdentifier(rest[skip:])
+	return name, name2, len(s) - len(rest) + skip + n2
+}
+
+/**
+* Index of the paren closes the first char of s
+ */
+func matchParen(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+/**
+* Split by sep, not in quote or paren
+ */
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			if part := strings.TrimSpace(s[start:i]); "" != part {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+
+	if part := strings.TrimSpace(s[start:]); "" != part {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+/**
+* Replace the text not in quote
+ */
+func mapOutsideQuotes(s string, fn func(string) string) string {
+	var result strings.Builder
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+				result.WriteString(s[start : i+1])
+				start = i + 1
+			}
+			continue
+		}
+
+		if c == '\'' || c == '"' || c == '`' {
+			result.WriteString(fn(s[start:i]))
+			start = i
+			quote = c
+		}
+	}
+
+	if quote != 0 {
+		result.WriteString(s[start:])
+	} else {
+		result.WriteString(fn(s[start:]))
+	}
+	return result.String()
+}
+
+/**
+* Replace line break and continuous space with one space, not in quote
+ */
+func collapseSpace(s string) string {
+	var result strings.Builder
+	var quote byte
+	space := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			result.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(s) {
+				i++
+				result.WriteByte(s[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			space = true
+			continue
+		}
+		if space && result.Len() > 0 {
+			result.WriteByte(' ')
+		}
+		space = false
+
+		if c == '\'' || c == '"' || c == '`' {
+			quote = c
+		}
+		result.WriteByte(c)
+	}
+	return result.String()
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
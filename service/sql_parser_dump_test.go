@@ -0,0 +1,138 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseMysqldump(t *testing.T) {
+	globalSet = &GlobalSet{}
+	source, err := parseSchemaFile("testdata/mysqldump.sql")
+	if nil != err {
+		t.Fatalf("parseSchemaFile() error: %v", err)
+	}
+
+	// The view placeholder table is replaced, the INSERT data is not parsed
+	var tables []string
+	for name := range source.Tables {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	if strings.Join(tables, ",") != "orders,users" {
+		t.Fatalf("tables = %v, want [orders users]", tables)
+	}
+
+	wantUsers := "CREATE TABLE `users` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(32) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if got := source.Tables["users"].SchemaRaw; got != wantUsers {
+		t.Errorf("users = %q, want %q", got, wantUsers)
+	}
+
+	orders := source.Tables["orders"]
+	if note := orders.FieldSchemas["note"]; nil == note || "a;b" != note.DefaultValue {
+		t.Errorf("orders.note = %+v, want default a;b", note)
+	}
+	if !strings.Contains(orders.Fields["note"], "COMMENT 'it''s; /* not a comment */'") {
+		t.Errorf("orders.note comment lost: %q", orders.Fields["note"])
+	}
+	if nil == orders.ForeignAll["fk_user"] || nil == orders.IndexAll["idx_user"] {
+		t.Errorf("orders keys = %v %v, want idx_user and fk_user", orders.IndexAll, orders.ForeignAll)
+	}
+	if strings.Contains(orders.SchemaRawNoInc, "AUTO_INCREMENT=") {
+		t.Errorf("orders AUTO_INCREMENT not removed: %q", orders.SchemaRawNoInc)
+	}
+
+	// DEFINER and the conditional comments are removed from the objects
+	wantObjects := map[string]string{
+		"VIEW v_user_orders": "CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `v_user_orders` AS select `u`.`id` AS `user_id`," +
+			"count(`o`.`id`) AS `orders` from (`users` `u` left join `orders` `o` on((`o`.`user_id` = `u`.`id`))) group by `u`.`id`",
+		"FUNCTION order_count": "CREATE FUNCTION `order_count`(uid int) RETURNS int\n    READS SQL DATA\nBEGIN\n" +
+			"  DECLARE n int;\n  SELECT COUNT(*) INTO n FROM orders WHERE user_id = uid;\n  RETURN n;\nEND",
+		"TRIGGER users_bi": "CREATE TRIGGER `users_bi` BEFORE INSERT ON `users` FOR EACH ROW BEGIN\n  SET NEW.name = TRIM(NEW.name);\nEND",
+	}
+	if len(source.Objects) != len(wantObjects) {
+		t.Errorf("objects = %v, want %d", source.Objects, len(wantObjects))
+	}
+	for _, obj := range source.Objects {
+		key := obj.Type + " " + obj.Name
+		if want, has := wantObjects[key]; !has {
+			t.Errorf("unexpected object %s", key)
+		} else if obj.SQL != want {
+			t.Errorf("%s = %q, want %q", key, obj.SQL, want)
+		}
+	}
+}
+
+func TestParseDumpStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		dbName  string
+		tables  string
+		wantErr bool
+	}{
+		{
+			name:    "drop removes the earlier definition",
+			content: "CREATE TABLE a (id int);\nDROP TABLE IF EXISTS a;\nCREATE TABLE a (id bigint);\n",
+			tables:  "a:bigint",
+		},
+		{
+			name:    "defined twice",
+			content: "CREATE TABLE a (id int);\nCREATE TABLE a (id int);\n",
+			wantErr: true,
+		},
+		{
+			name:    "index added by alter table",
+			content: "CREATE TABLE a (id int, name varchar(8));\nALTER TABLE a ADD KEY idx_name (name);\nALTER TABLE `a` DISABLE KEYS;\n",
+			tables:  "a:int",
+		},
+		{
+			name: "databases need InputDbName",
+			content: "CREATE DATABASE `shop`;\nUSE `shop`;\nCREATE TABLE a (id int);\n" +
+				"CREATE DATABASE `crm`;\nUSE `crm`;\nCREATE TABLE b (id int);\n",
+			wantErr: true,
+		},
+		{
+			name: "statements of InputDbName",
+			content: "CREATE DATABASE `shop`;\nUSE `shop`;\nCREATE TABLE a (id int);\n" +
+				"CREATE DATABASE `crm`;\nUSE `crm`;\nCREATE TABLE b (id int);\nCREATE TABLE `shop`.`c` (id int);\n",
+			dbName: "shop",
+			tables: "a:int,c:int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globalSet = &GlobalSet{InputDbName: tt.dbName}
+			tables, _, err := parseSchemaStatements(splitSQLStatements(tt.content))
+			if tt.wantErr {
+				if nil == err {
+					t.Fatalf("parseSchemaStatements() want error")
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("parseSchemaStatements() error: %v", err)
+			}
+
+			var got []string
+			for name, mys := range tables {
+				got = append(got, name+":"+mys.FieldSchemas["id"].ColumnType)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != tt.tables {
+				t.Errorf("tables = %v, want %s", got, tt.tables)
+			}
+		})
+	}
+
+	globalSet = &GlobalSet{}
+	tables, _, _ := parseSchemaStatements(splitSQLStatements("CREATE TABLE a (id int, name varchar(8));\nALTER TABLE a ADD KEY idx_name (name);\n"))
+	if nil == tables["a"].IndexAll["idx_name"] {
+		t.Errorf("index of alter table not merged: %q", tables["a"].SchemaRaw)
+	}
+}
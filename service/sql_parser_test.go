@@ -0,0 +1,200 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "simple",
+			content: "CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n",
+			want:    []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"},
+		},
+		{
+			name:    "missing last delimiter",
+			content: "SELECT 1;\nSELECT 2",
+			want:    []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:    "semicolon in quotes",
+			content: "CREATE TABLE a (s varchar(8) DEFAULT 'a;b' COMMENT \"c;d\", `e;f` int);",
+			want:    []string{"CREATE TABLE a (s varchar(8) DEFAULT 'a;b' COMMENT \"c;d\", `e;f` int)"},
+		},
+		{
+			name:    "doubled and backslash escaped quotes",
+			content: "INSERT INTO a VALUES ('it''s;', 'x\\';y');SELECT 2;",
+			want:    []string{"INSERT INTO a VALUES ('it''s;', 'x\\';y')", "SELECT 2"},
+		},
+		{
+			name:    "comments",
+			content: "-- drop; it\n# another; one\n/* block; comment */SELECT 1;--\nSELECT 2;",
+			want:    []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:    "double dash without space is not a comment",
+			content: "SELECT 1--1;",
+			want:    []string{"SELECT 1--1"},
+		},
+		{
+			name:    "conditional comments",
+			content: "/*!40101 SET NAMES utf8mb4 */;\nCREATE TABLE a (id int) /*!50100 PARTITION BY HASH (id) */;",
+			want:    []string{"SET NAMES utf8mb4", "CREATE TABLE a (id int)   PARTITION BY HASH (id)"},
+		},
+		{
+			name: "delimiter",
+			content: "DELIMITER ;;\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END ;;\nDELIMITER ;\n" +
+				"CREATE TABLE a (id int);",
+			want: []string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "CREATE TABLE a (id int)"},
+		},
+		{
+			name:    "delimiter keyword only at statement start",
+			content: "SELECT 'DELIMITER $$';",
+			want:    []string{"SELECT 'DELIMITER $$'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSQLStatements(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCreateTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		stmt   string
+		table  string
+		schema string
+	}{
+		{
+			name:  "bare names and lower types",
+			stmt:  "create table IF NOT EXISTS shop.user (id INT UNSIGNED NOT NULL, name VARCHAR(20) DEFAULT 'a;b', primary key (id), unique index uk_name (name)) engine = InnoDB default charset utf8mb4",
+			table: "user",
+			schema: "CREATE TABLE `user` (\n" +
+				"  `id` int unsigned NOT NULL,\n" +
+				"  `name` varchar(20) DEFAULT 'a;b',\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  UNIQUE KEY `uk_name` (`name`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		},
+		{
+			name:  "unnamed foreign keys are named as mysql does",
+			stmt:  "CREATE TABLE `b` (`id` int, `a_id` int, FOREIGN KEY (a_id) REFERENCES a (id), FOREIGN KEY (id) REFERENCES a (id))",
+			table: "b",
+			schema: "CREATE TABLE `b` (\n" +
+				"  `id` int,\n" +
+				"  `a_id` int,\n" +
+				"  CONSTRAINT `b_ibfk_1` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`),\n" +
+				"  CONSTRAINT `b_ibfk_2` FOREIGN KEY (`id`) REFERENCES `a` (`id`)\n" +
+				")",
+		},
+		{
+			name:  "spaces collapsed outside quotes",
+			stmt:  "CREATE TABLE t (\n\tc   varchar(8)   COMMENT 'two  spaces,\tkept'\n)",
+			table: "t",
+			schema: "CREATE TABLE `t` (\n" +
+				"  `c` varchar(8) COMMENT 'two  spaces,\tkept'\n" +
+				")",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, schema, err := normalizeCreateTable(tt.stmt)
+			if nil != err {
+				t.Fatalf("normalizeCreateTable() error: %v", err)
+			}
+			if table != tt.table || schema != tt.schema {
+				t.Errorf("normalizeCreateTable() = %q, %q\nwant %q, %q", table, schema, tt.table, tt.schema)
+			}
+		})
+	}
+
+	for _, stmt := range []string{"CREATE VIEW v AS SELECT 1", "CREATE TABLE t (id int", "CREATE TABLE t ()"} {
+		if _, _, err := normalizeCreateTable(stmt); nil == err {
+			t.Errorf("normalizeCreateTable(%q) want error", stmt)
+		}
+	}
+}
+
+func TestParseFieldSchema(t *testing.T) {
+	tests := []struct {
+		line       string
+		columnType string
+		allowNull  bool
+		defValue   string
+	}{
+		{"`id` int(10) unsigned NOT NULL AUTO_INCREMENT,", "int(10) unsigned", false, ""},
+		{"`name` varchar(20) DEFAULT 'it''s',", "varchar(20)", true, "it's"},
+		{"`path` varchar(64) DEFAULT 'C:\\\\tmp'", "varchar(64)", true, "C:\\tmp"},
+		{"`status` enum('a b','c') NOT NULL DEFAULT 'a b'", "enum('a b','c')", false, "a b"},
+		{"`price` decimal(10,2) zerofill DEFAULT NULL", "decimal(10,2) zerofill", true, ""},
+		{"`code` int PRIMARY KEY", "int", false, ""},
+	}
+
+	for _, tt := range tests {
+		fs := parseFieldSchema(tt.line)
+		if fs.ColumnType != tt.columnType || fs.AllowNull != tt.allowNull || fs.DefaultValue != tt.defValue {
+			t.Errorf("parseFieldSchema(%q) = %q, null %v, default %q\nwant %q, null %v, default %q",
+				tt.line, fs.ColumnType, fs.AllowNull, fs.DefaultValue, tt.columnType, tt.allowNull, tt.defValue)
+		}
+	}
+}
+
+func TestNormalizeColumnType(t *testing.T) {
+	tests := []struct {
+		colType string
+		want    string
+	}{
+		{"int(10) unsigned", "int unsigned"},
+		{"INT UNSIGNED", "int unsigned"},
+		{"integer(11)", "int"},
+		{"bigint(20)", "bigint"},
+		{"tinyint(4)", "tinyint"},
+		{"tinyint(1)", "tinyint(1)"},
+		{"boolean", "tinyint(1)"},
+		{"int(5) unsigned zerofill", "int(5) unsigned zerofill"},
+		{"varchar(20)", "varchar(20)"},
+		{"DECIMAL(10, 2)", "decimal(10,2)"},
+		{"enum('A b','c')", "enum('A b','c')"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeColumnType(tt.colType); got != tt.want {
+			t.Errorf("normalizeColumnType(%q) = %q, want %q", tt.colType, got, tt.want)
+		}
+	}
+}
+
+func TestUnquoteValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"NULL", ""},
+		{"'it''s'", "it's"},
+		{`'it\'s'`, "it's"},
+		{`'a\\b'`, `a\b`},
+		{`'line\nnext'`, "line\nnext"},
+		{`'100\%'`, `100\%`},
+		{"CURRENT_TIMESTAMP", "CURRENT_TIMESTAMP"},
+	}
+
+	for _, tt := range tests {
+		if got := unquoteValue(tt.value); got != tt.want {
+			t.Errorf("unquoteValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if "NULL" != tt.value && "CURRENT_TIMESTAMP" != tt.value && unquoteValue(quoteString(tt.want)) != tt.want {
+			t.Errorf("quoteString(%q) not unquoted back", tt.want)
+		}
+	}
+}
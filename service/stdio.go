@@ -0,0 +1,59 @@
+// Stdin / stdout for shell pipelines
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// path of stdin or stdout, ex: -i - / -o -
+const stdioPath = "-"
+
+// stdout of the streamed sql, main redirects os.Stdout (the progress messages) to stderr when streaming
+var stdout = os.Stdout
+
+var stdoutLock sync.Mutex
+
+var stdinRead bool
+
+/**
+* Read the input file, or stdin for "-"; stdin can be read once
+ */
+func readInput(path string) ([]byte, error) {
+	if stdioPath != path {
+		return ioutil.ReadFile(path)
+	}
+	if stdinRead {
+		return nil, fmt.Errorf("stdin is already read, only one input can be -")
+	}
+	stdinRead = true
+	return ioutil.ReadAll(os.Stdin)
+}
+
+/**
+* Write to the output file, or stdout for "-"
+ */
+func writeOutput(path string, data []byte) error {
+	if stdioPath == path {
+		return writeStdout(string(data))
+	}
+	if dir := filepath.Dir(path); "" != dir {
+		if err := os.MkdirAll(dir, os.ModePerm); nil != err {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+/**
+* Write to stdout, the output of each dest db is not interleaved
+ */
+func writeStdout(str string) error {
+	stdoutLock.Lock()
+	defer stdoutLock.Unlock()
+	_, err := stdout.WriteString(str)
+	return err
+}
@@ -32,6 +32,9 @@ func (at AlterType) String() string {
 
 }
 
+// change of one table. SchemaDiff.Source is nil for a drop, SchemaDiff.Dest is nil for a create.
+// The foreign key passes of a dependency cycle (see sortTableAlters) are alters with the SchemaDiff of their table:
+// the keys added after create have a nil Dest, the keys dropped before drop table have a nil Source
 type TableAlterData struct {
 	Table      string
 	Type       AlterType
@@ -40,13 +43,17 @@ type TableAlterData struct {
 }
 
 func (ta *TableAlterData) String() string {
-	relationTables := ta.SchemaDiff.RelationTables()
+	var relationTables []string
+	if nil != ta.SchemaDiff {
+		relationTables = ta.SchemaDiff.RelationTables()
+	}
 	fmtStr := `
 -- Table : %s
 -- Type  : %s
--- RealtionTables : %s
+-- RelationTables : %s
 -- SQL   :
 %s
 `
-	return fmt.Sprintf(fmtStr, ta.Table, ta.Type, strings.Join(relationTables, ","), ta.SQL)
+	sql := strings.TrimRight(strings.TrimSpace(ta.SQL), ";") + ";"
+	return fmt.Sprintf(fmtStr, ta.Table, ta.Type, strings.Join(relationTables, ","), sql)
 }
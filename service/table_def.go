@@ -0,0 +1,444 @@
+// Declarative table definition
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var foreignKeyDefReg = regexp.MustCompile("(?i)^CONSTRAINT\\s+(`[^`]+`|\\S+)\\s+FOREIGN KEY\\s*\\(([^)]*)\\)\\s*REFERENCES\\s+(\\S+)\\s*\\(([^)]*)\\)(.*)$")
+
+// table defined out of sql, ex: go struct, yaml
+type tableDef struct {
+	Name    string
+	Columns []*columnDef
+	Indexes []*indexDef
+	Foreign []*foreignKeyDef
+	Options string // table options, ex: ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	Comment string
+}
+
+// column of tableDef
+type columnDef struct {
+	Name          string
+	Type          string // column type, ex: varchar(64), bigint unsigned
+	Charset       string
+	Collate       string
+	NotNull       bool
+	AutoIncrement bool
+	Default       *string // nil: no default
+	OnUpdate      string  // ex: CURRENT_TIMESTAMP
+	Comment       string
+}
+
+// index of tableDef
+type indexDef struct {
+	Name    string
+	Kind    string   // PRIMARY, UNIQUE, KEY, FULLTEXT or SPATIAL
+	Columns []string // column name, with prefix length, ex: name(10)
+}
+
+// foreign key of tableDef
+type foreignKeyDef struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string // ex: CASCADE
+	OnUpdate   string
+}
+
+/**
+* Column by name
+ */
+func (td *tableDef) column(name string) *columnDef {
+	for _, col := range td.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+/**
+* Add the column to the index, create the index when not exists
+ */
+func (td *tableDef) addIndexColumn(name, kind, column string) {
+	for _, idx := range td.Indexes {
+		if idx.Name == name {
+			idx.Columns = append(idx.Columns, column)
+			if kind != "KEY" { // any column marked unique (or fulltext)
+				idx.Kind = kind
+			}
+			return
+		}
+	}
+	td.Indexes = append(td.Indexes, &indexDef{Name: name, Kind: kind, Columns: []string{column}})
+}
+
+/**
+* Create table sql of the definition
+ */
+func (td *tableDef) createSQL() string {
+	var lines []string
+	for _, col := range td.Columns {
+		lines = append(lines, col.definition())
+	}
+	for _, idx := range td.Indexes {
+		lines = append(lines, idx.definition())
+	}
+	for _, fk := range td.Foreign {
+		if !td.hasIndexPrefix(fk.Columns) { // mysql creates the index of foreign key
+			lines = append(lines, (&indexDef{Name: fk.Name, Kind: "KEY", Columns: fk.Columns}).definition())
+		}
+	}
+	for _, fk := range td.Foreign {
+		lines = append(lines, fk.definition())
+	}
+
+	sql := fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", quoteIdentifier(td.Name), strings.Join(lines, ",\n  "))
+	if "" != td.Options {
+		sql += " " + td.Options
+	}
+	if "" != td.Comment {
+		sql += " COMMENT=" + quoteString(td.Comment)
+	}
+	return sql
+}
+
+/**
+* Some index starts with the columns
+ */
+func (td *tableDef) hasIndexPrefix(columns []string) bool {
+	for _, idx := range td.Indexes {
+		if len(idx.Columns) < len(columns) {
+			continue
+		}
+		match := true
+		for i, col := range columns {
+			if idx.Columns[i] != col {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* Foreign key definition
+ */
+func (fk *foreignKeyDef) definition() string {
+	quoteList := func(names []string) string {
+		quoted := make([]string, 0, len(names))
+		for _, name := range names {
+			quoted = append(quoted, quoteIdentifier(name))
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	def := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteIdentifier(fk.Name), quoteList(fk.Columns), quoteIdentifier(fk.RefTable), quoteList(fk.RefColumns))
+	if "" != fk.OnDelete {
+		def += " ON DELETE " + strings.ToUpper(fk.OnDelete)
+	}
+	if "" != fk.OnUpdate {
+		def += " ON UPDATE " + strings.ToUpper(fk.OnUpdate)
+	}
+	return def
+}
+
+/**
+* Column definition, same order as SHOW CREATE TABLE
+ */
+func (col *columnDef) definition() string {
+	def := quoteIdentifier(col.Name) + " " + col.Type
+	if "" != col.Charset {
+		def += " CHARACTER SET " + col.Charset
+	}
+	if "" != col.Collate {
+		def += " COLLATE " + col.Collate
+	}
+	if col.NotNull {
+		def += " NOT NULL"
+	}
+	if col.AutoIncrement {
+		def += " AUTO_INCREMENT"
+	}
+	if nil != col.Default {
+		def += " DEFAULT " + defaultValueSQL(*col.Default)
+	} else if !col.NotNull && !col.AutoIncrement && !isBlobType(col.Type) {
+		def += " DEFAULT NULL"
+	}
+	if "" != col.OnUpdate {
+		def += " ON UPDATE " + col.OnUpdate
+	}
+	if "" != col.Comment {
+		def += " COMMENT " + quoteString(col.Comment)
+	}
+	return def
+}
+
+/**
+* Index definition
+ */
+func (idx *indexDef) definition() string {
+	cols := make([]string, 0, len(idx.Columns))
+	for _, col := range idx.Columns {
+		if p := strings.IndexAny(col, "( "); p > 0 { // prefix length or DESC
+			cols = append(cols, quoteIdentifier(col[:p])+col[p:])
+		} else {
+			cols = append(cols, quoteIdentifier(col))
+		}
+	}
+
+	switch idx.Kind {
+	case "PRIMARY":
+		return fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(cols, ","))
+	case "KEY", "":
+		return fmt.Sprintf("KEY %s (%s)", quoteIdentifier(idx.Name), strings.Join(cols, ","))
+	}
+	return fmt.Sprintf("%s KEY %s (%s)", idx.Kind, quoteIdentifier(idx.Name), strings.Join(cols, ","))
+}
+
+/**
+* Table definition of the parsed schema, columns and indexes in the create order
+ */
+func tableDefFromSchema(name string, mys *MySchema) *tableDef {
+	td := &tableDef{Name: name}
+	lines := strings.Split(mys.SchemaRawNoInc, "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(strings.TrimSpace(line), ",")
+		switch {
+		case strings.HasPrefix(line, "`"):
+			td.Columns = append(td.Columns, parseColumnDef(line))
+		case strings.HasPrefix(line, ")"):
+			td.Options, td.Comment = splitTableComment(strings.TrimSpace(line[1:]))
+		default:
+			if idx := parseIndexDef(line); nil != idx {
+				td.Indexes = append(td.Indexes, idx)
+			} else if fk := parseForeignKeyDef(line); nil != fk {
+				td.Foreign = append(td.Foreign, fk)
+			}
+		}
+	}
+	return td
+}
+
+/**
+* Parser column definition of SHOW CREATE TABLE
+ */
+func parseColumnDef(line string) *columnDef {
+	name, n := readIdentifier(line)
+	col := &columnDef{Name: name}
+	tokens := splitOutsideQuotes(strings.TrimSpace(line[n:]), ' ')
+	if len(tokens) == 0 {
+		return col
+	}
+
+	col.Type = tokens[0]
+	i := 1
+	for ; i < len(tokens) && inStringSlice(strings.ToLower(tokens[i]), []string{"unsigned", "zerofill"}); i++ {
+		col.Type += " " + strings.ToLower(tokens[i])
+	}
+
+	next := func() string {
+		if i+1 < len(tokens) {
+			i++
+			return tokens[i]
+		}
+		return ""
+	}
+	for ; i < len(tokens); i++ {
+		switch strings.ToUpper(tokens[i]) {
+		case "CHARACTER":
+			next() // SET
+			col.Charset = next()
+		case "COLLATE":
+			col.Collate = next()
+		case "NOT":
+			next() // NULL
+			col.NotNull = true
+		case "AUTO_INCREMENT":
+			col.AutoIncrement = true
+		case "DEFAULT":
+			if value := next(); "NULL" != strings.ToUpper(value) {
+				if strings.HasPrefix(value, "'") {
+					value = unquoteValue(value)
+				}
+				col.Default = &value
+			}
+		case "ON":
+			next() // UPDATE
+			col.OnUpdate = next()
+		case "COMMENT":
+			col.Comment = unquoteValue(next())
+		}
+	}
+	return col
+}
+
+/**
+* Parser index definition of SHOW CREATE TABLE, nil when it is not index
+ */
+func parseIndexDef(line string) *indexDef {
+	idx := &indexDef{}
+	upper := strings.ToUpper(line)
+	switch {
+	case strings.HasPrefix(upper, "PRIMARY KEY"):
+		idx.Kind = "PRIMARY"
+		line = line[len("PRIMARY KEY"):]
+	case strings.HasPrefix(upper, "KEY "):
+		idx.Kind = "KEY"
+		line = line[len("KEY "):]
+	default:
+		kind := strings.SplitN(upper, " ", 2)[0]
+		if !inStringSlice(kind, []string{"UNIQUE", "FULLTEXT", "SPATIAL"}) || !strings.HasPrefix(upper[len(kind):], " KEY ") {
+			return nil
+		}
+		idx.Kind = kind
+		line = line[len(kind)+len(" KEY "):]
+	}
+
+	line = strings.TrimSpace(line)
+	if "PRIMARY" != idx.Kind {
+		var n int
+		idx.Name, n = readIdentifier(line)
+		line = strings.TrimSpace(line[n:])
+	}
+	end := matchParen(line)
+	if !strings.HasPrefix(line, "(") || end < 0 {
+		return nil
+	}
+	for _, col := range splitOutsideQuotes(line[1:end], ',') {
+		name, n := readIdentifier(strings.TrimSpace(col))
+		idx.Columns = append(idx.Columns, name+strings.TrimSpace(col)[n:])
+	}
+	return idx
+}
+
+/**
+* Parser foreign key definition of SHOW CREATE TABLE, nil when it is not foreign key
+ */
+func parseForeignKeyDef(line string) *foreignKeyDef {
+	m := foreignKeyDefReg.FindStringSubmatch(line)
+	if nil == m {
+		return nil
+	}
+
+	readList := func(list string) []string {
+		var names []string
+		for _, name := range splitOutsideQuotes(list, ',') {
+			name, _ = readIdentifier(strings.TrimSpace(name))
+			names = append(names, name)
+		}
+		return names
+	}
+	fk := &foreignKeyDef{Columns: readList(m[2]), RefColumns: readList(m[4])}
+	fk.Name, _ = readIdentifier(m[1])
+	_, fk.RefTable, _ = readQualifiedName(m[3])
+
+	rest := strings.ToUpper(m[5])
+	for _, action := range []string{"RESTRICT", "CASCADE", "SET NULL", "NO ACTION", "SET DEFAULT"} {
+		if strings.Contains(rest, "ON DELETE "+action) {
+			fk.OnDelete = action
+		}
+		if strings.Contains(rest, "ON UPDATE "+action) {
+			fk.OnUpdate = action
+		}
+	}
+	return fk
+}
+
+/**
+* Split the table options and the table comment
+ */
+func splitTableComment(options string) (string, string) {
+	var kept []string
+	comment := ""
+	for _, option := range splitOutsideQuotes(options, ' ') {
+		if strings.HasPrefix(strings.ToUpper(option), "COMMENT=") {
+			comment = unquoteValue(option[len("COMMENT="):])
+		} else if "" != option {
+			kept = append(kept, option)
+		}
+	}
+	return strings.Join(kept, " "), comment
+}
+
+/**
+* Default value in sql, quote the value except NULL and function, same as SHOW CREATE TABLE
+ */
+func defaultValueSQL(value string) string {
+	upper := strings.ToUpper(value)
+	if "NULL" == upper || strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.HasPrefix(value, "(") {
+		return value
+	}
+	if len(value) >= 2 && value[len(value)-1] == '\'' && strings.Contains("'bBxX", value[:1]) { // quoted already, or bit / hex value
+		return value
+	}
+	return quoteString(value)
+}
+
+/**
+* Blob and text column has no default
+ */
+func isBlobType(colType string) bool {
+	colType = strings.ToLower(colType)
+	return strings.HasSuffix(colType, "blob") || strings.HasSuffix(colType, "text") ||
+		"json" == colType || "geometry" == colType
+}
+
+// Quote identifier, ex: order -> `order`
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+/**
+* Parser the definition to table schema
+ */
+func (td *tableDef) schema() (*MySchema, error) {
+	_, schema, err := normalizeCreateTable(td.createSQL())
+	if nil != err {
+		return nil, err
+	}
+	return parseSchemaWithFields(schema), nil
+}
+
+/**
+* Camel case to snake case, ex: UserID -> user_id
+ */
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var buf strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				buf.WriteByte('_')
+			}
+		}
+		buf.WriteRune(unicode.ToLower(r))
+	}
+	return buf.String()
+}
+
+/**
+* Plural of english noun, the simple rules, ex: user -> users, company -> companies
+ */
+func pluralName(name string) string {
+	switch {
+	case strings.HasSuffix(name, "s") || strings.HasSuffix(name, "x") || strings.HasSuffix(name, "z") ||
+		strings.HasSuffix(name, "ch") || strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
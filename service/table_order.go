@@ -0,0 +1,224 @@
+// Foreign key dependency ordering of table changes
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/**
+* Order table changes by foreign key dependency:
+* create / alter the referenced tables first, drop the referencing tables first,
+* foreign keys in a dependency cycle are added in a final pass, or dropped before drop table.
+* The create and the drop of a cycle have the SchemaDiff without the keys, the key passes the SchemaDiff with them
+ */
+func sortTableAlters(alters []*TableAlterData) []*TableAlterData {
+	var changes, drops []*TableAlterData
+	for _, alter := range alters {
+		if alter.Type == alterTypeDrop {
+			drops = append(drops, alter)
+		} else {
+			changes = append(changes, alter)
+		}
+	}
+
+	ordered, cyclic := topoSortAlters(changes)
+	var foreignPass []*TableAlterData
+	if len(cyclic) > 0 {
+		// Create the cyclic tables without foreign keys, add the keys at last
+		var stripped []*TableAlterData
+		for _, alter := range cyclic {
+			if alter.Type == alterTypeCreate && len(alter.SchemaDiff.Source.ForeignAll) > 0 {
+				foreignPass = append(foreignPass, newForeignKeyAlter(alter))
+
+				source := *alter.SchemaDiff.Source
+				source.ForeignAll = make(map[string]*DbIndex)
+				schemaDiff := *alter.SchemaDiff
+				schemaDiff.Source = &source
+				alter = &TableAlterData{
+					Table:      alter.Table,
+					Type:       alter.Type,
+					SQL:        removeForeignKeys(source.SchemaRaw) + ";",
+					SchemaDiff: &schemaDiff,
+				}
+			}
+			stripped = append(stripped, alter)
+		}
+
+		var rest []*TableAlterData
+		stripped, rest = topoSortAlters(stripped)
+		ordered = append(ordered, stripped...)
+		ordered = append(ordered, rest...) // cycle of alter only, keep the name order
+	}
+
+	// Drop the referencing tables first
+	dropOrdered, dropCyclic := topoSortAlters(drops)
+	for i, j := 0, len(dropOrdered)-1; i < j; i, j = i+1, j-1 {
+		dropOrdered[i], dropOrdered[j] = dropOrdered[j], dropOrdered[i]
+	}
+	for i, alter := range dropCyclic {
+		// Drop the foreign keys of the cyclic tables before drop table
+		if fkAlter := newDropForeignKeyAlter(alter); nil != fkAlter {
+			ordered = append(ordered, fkAlter)
+
+			// the dropped table is restored (down migration) without the keys, they are restored by the key pass
+			dest := *alter.SchemaDiff.Dest
+			dest.SchemaRaw = removeForeignKeys(dest.SchemaRaw)
+			dest.SchemaRawNoInc = removeForeignKeys(dest.SchemaRawNoInc)
+			dest.ForeignAll = make(map[string]*DbIndex)
+			schemaDiff := *alter.SchemaDiff
+			schemaDiff.Dest = &dest
+			dropCyclic[i] = &TableAlterData{
+				Table:      alter.Table,
+				Type:       alter.Type,
+				SQL:        alter.SQL,
+				SchemaDiff: &schemaDiff,
+			}
+		}
+	}
+	ordered = append(ordered, dropOrdered...)
+	ordered = append(ordered, dropCyclic...)
+
+	return append(ordered, foreignPass...)
+}
+
+/**
+* Kahn topological sort, table before the tables reference it.
+* return the sorted list and the tables in (or after) a dependency cycle
+ */
+func topoSortAlters(alters []*TableAlterData) ([]*TableAlterData, []*TableAlterData) {
+	byTable := make(map[string]*TableAlterData, len(alters))
+	for _, alter := range alters {
+		byTable[alter.Table] = alter
+	}
+
+	depends := make(map[string]map[string]bool, len(alters)) // table -> referenced tables
+	referrers := make(map[string][]string, len(alters))      // table -> referencing tables
+	for _, alter := range alters {
+		depends[alter.Table] = make(map[string]bool)
+		for _, tb := range alterRelationTables(alter) {
+			if _, has := byTable[tb]; !has || tb == alter.Table || depends[alter.Table][tb] {
+				continue
+			}
+			depends[alter.Table][tb] = true
+			referrers[tb] = append(referrers[tb], alter.Table)
+		}
+	}
+
+	var ready []string
+	for table, deps := range depends {
+		if len(deps) == 0 {
+			ready = append(ready, table)
+		}
+	}
+
+	var ordered []*TableAlterData
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		table := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, byTable[table])
+
+		for _, ref := range referrers[table] {
+			delete(depends[ref], table)
+			if len(depends[ref]) == 0 {
+				ready = append(ready, ref)
+			}
+		}
+		delete(depends, table)
+	}
+
+	var cyclic []string
+	for table := range depends {
+		cyclic = append(cyclic, table)
+	}
+	sort.Strings(cyclic)
+
+	var rest []*TableAlterData
+	for _, table := range cyclic {
+		rest = append(rest, byTable[table])
+	}
+	return ordered, rest
+}
+
+/**
+* Tables referenced by the foreign keys of the changed table
+ */
+func alterRelationTables(alter *TableAlterData) []string {
+	if nil == alter.SchemaDiff {
+		return nil
+	}
+	return alter.SchemaDiff.RelationTables()
+}
+
+/**
+* Remove foreign key lines from create table sql
+ */
+func removeForeignKeys(schema string) string {
+	lines := strings.Split(schema, "\n")
+	var kept []string
+	for _, line := range lines {
+		trimLine := strings.TrimSpace(line)
+		if strings.HasPrefix(trimLine, "CONSTRAINT ") && fkeyReg.MatchString(strings.TrimRight(trimLine, ",")) {
+			continue
+		}
+
+		// the last definition before the extend info has no comma
+		if strings.HasPrefix(trimLine, ")") && len(kept) > 0 {
+			kept[len(kept)-1] = strings.TrimRight(kept[len(kept)-1], ",")
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+/**
+* Add the foreign keys of a created table
+ */
+func newForeignKeyAlter(alter *TableAlterData) *TableAlterData {
+	var names []string
+	for name := range alter.SchemaDiff.Source.ForeignAll {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, alter.SchemaDiff.Source.ForeignAll[name].alterAddSQL(false))
+	}
+
+	return &TableAlterData{
+		Table:      alter.Table,
+		Type:       alterTypeAlter,
+		SQL:        fmt.Sprintf("ALTER TABLE `%s` %s;", alter.Table, strings.Join(lines, ",\n")),
+		SchemaDiff: alter.SchemaDiff,
+	}
+}
+
+/**
+* Drop the foreign keys of a table before drop it
+ */
+func newDropForeignKeyAlter(alter *TableAlterData) *TableAlterData {
+	if nil == alter.SchemaDiff || nil == alter.SchemaDiff.Dest || len(alter.SchemaDiff.Dest.ForeignAll) == 0 {
+		return nil
+	}
+
+	var names []string
+	for name := range alter.SchemaDiff.Dest.ForeignAll {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, alter.SchemaDiff.Dest.ForeignAll[name].alterDropSQL())
+	}
+
+	return &TableAlterData{
+		Table:      alter.Table,
+		Type:       alterTypeAlter,
+		SQL:        fmt.Sprintf("ALTER TABLE `%s` %s;", alter.Table, strings.Join(lines, ",\n")),
+		SchemaDiff: alter.SchemaDiff,
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+* Table, type and sql of each change, one line each
+ */
+func planLines(plan []*TableAlterData) string {
+	var lines []string
+	for _, sd := range plan {
+		lines = append(lines, sd.Table+" "+sd.Type.String()+": "+strings.Replace(sd.SQL, "\n", " ", -1))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSortTableAltersForeignKeyCycle(t *testing.T) {
+	globalSet = &GlobalSet{}
+
+	// The tables are created without the keys, the keys are added at last
+	want := "a create: CREATE TABLE `a` (   `id` int NOT NULL,   `b_id` int DEFAULT NULL,   PRIMARY KEY (`id`),   KEY `fk_a_b` (`b_id`) ) ENGINE=InnoDB;\n" +
+		"b create: CREATE TABLE `b` (   `id` int NOT NULL,   `a_id` int DEFAULT NULL,   PRIMARY KEY (`id`),   KEY `fk_b_a` (`a_id`) ) ENGINE=InnoDB;\n" +
+		"a alter: ALTER TABLE `a` ADD CONSTRAINT `fk_a_b` FOREIGN KEY (`b_id`) REFERENCES `b` (`id`);\n" +
+		"b alter: ALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);"
+	plan := cyclePlan(alterTypeCreate)
+	if got := planLines(plan); got != want {
+		t.Errorf("create plan =\n%s\nwant\n%s", got, want)
+	}
+	if nil != plan[0].SchemaDiff.Dest || len(plan[0].SchemaDiff.Source.ForeignAll) != 0 || nil != plan[2].SchemaDiff.Dest {
+		t.Errorf("create plan SchemaDiff: the create without keys, the key pass with the source keys")
+	}
+
+	// The keys are dropped before the tables
+	want = "a alter: ALTER TABLE `a` DROP FOREIGN KEY `fk_a_b`;\n" +
+		"b alter: ALTER TABLE `b` DROP FOREIGN KEY `fk_b_a`;\n" +
+		"a drop: DROP TABLE `a`;\n" +
+		"b drop: DROP TABLE `b`;"
+	plan = cyclePlan(alterTypeDrop)
+	if got := planLines(plan); got != want {
+		t.Errorf("drop plan =\n%s\nwant\n%s", got, want)
+	}
+	if nil != plan[0].SchemaDiff.Source || len(plan[0].SchemaDiff.Dest.ForeignAll) != 1 || len(plan[2].SchemaDiff.Dest.ForeignAll) != 0 {
+		t.Errorf("drop plan SchemaDiff: the key pass with the dest keys, the drop without keys")
+	}
+
+	// Alters of a cycle keep the name order, a created table referencing the cycle is created after it
+	var alters []*TableAlterData
+	for _, table := range []string{"b", "a"} {
+		schema := ParseSchema(cycleSchemas[table])
+		alters = append(alters, &TableAlterData{Table: table, Type: alterTypeAlter,
+			SQL: "ALTER TABLE `" + table + "` ADD `c` int;", SchemaDiff: &SchemaDiff{Table: table, Source: schema, Dest: schema}})
+	}
+	c := "CREATE TABLE `c` (\n  `a_id` int DEFAULT NULL,\n  KEY `fk_c_a` (`a_id`),\n" +
+		"  CONSTRAINT `fk_c_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`)\n) ENGINE=InnoDB"
+	alters = append(alters, &TableAlterData{Table: "c", Type: alterTypeCreate, SQL: c + ";",
+		SchemaDiff: &SchemaDiff{Table: "c", Source: ParseSchema(c)}})
+	want = "c create: CREATE TABLE `c` (   `a_id` int DEFAULT NULL,   KEY `fk_c_a` (`a_id`) ) ENGINE=InnoDB;\n" +
+		"a alter: ALTER TABLE `a` ADD `c` int;\n" +
+		"b alter: ALTER TABLE `b` ADD `c` int;\n" +
+		"c alter: ALTER TABLE `c` ADD CONSTRAINT `fk_c_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);"
+	if got := planLines(sortTableAlters(alters)); got != want {
+		t.Errorf("alter plan =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,18 @@
+package gomodels
+
+// User is a gorm model
+type User struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;not null;index:idx_name_age,unique"`
+	Age  int    `gorm:"index:idx_name_age,sort:desc"`
+	Bio  string `gorm:"type:text;index:,class:FULLTEXT"`
+	Code string `gorm:"size:32;index:idx_code,length:10"`
+	Nick *string
+}
+
+// Account is a sqlx model
+type Account struct {
+	ID   int64   `db:"id"`
+	Name string  `db:"name"`
+	Note *string `db:"note"`
+}
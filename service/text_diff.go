@@ -0,0 +1,259 @@
+// Unified text diff of the table definitions
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lines of context around the changes, as diff -u
+const diffContextLines = 3
+
+const (
+	DiffColorAuto   = "auto" // color when the output is a terminal
+	DiffColorAlways = "always"
+	DiffColorNever  = "never"
+)
+
+// Supported diff color settings
+var DiffColors = []string{DiffColorAuto, DiffColorAlways, DiffColorNever}
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+// line of the edit script
+type diffLine struct {
+	Op   byte // ' ', '-' or '+'
+	Text string
+}
+
+/**
+* Print the definition diff of each changed table, when TableDiff is set.
+* A table in a foreign key cycle has more changes, the first one has the whole definitions (see sortTableAlters)
+ */
+func printTableDiffs(destName string, plan []*TableAlterData) {
+	if !globalSet.TableDiff || len(plan) == 0 {
+		return
+	}
+
+	var buf strings.Builder
+	printed := make(map[string]bool, len(plan))
+	for _, sd := range plan {
+		if !printed[sd.Table] {
+			printed[sd.Table] = true
+			buf.WriteString(sd.textDiff(destName))
+		}
+	}
+	if useDiffColor() {
+		fmt.Print(colorDiff(buf.String()))
+	} else {
+		fmt.Print(buf.String())
+	}
+}
+
+/**
+* Unified diff from the dest create table to the source create table
+ */
+func (ta *TableAlterData) textDiff(destName string) string {
+	var from, to string
+	if nil != ta.SchemaDiff && nil != ta.SchemaDiff.Dest {
+		from = ta.SchemaDiff.Dest.SchemaRawNoInc
+	}
+	if nil != ta.SchemaDiff && nil != ta.SchemaDiff.Source {
+		to = ta.SchemaDiff.Source.SchemaRawNoInc
+	}
+
+	fromName, toName := destName+"/"+ta.Table, "source/"+ta.Table
+	if "" == from {
+		fromName = "/dev/null"
+	}
+	if "" == to {
+		toName = "/dev/null"
+	}
+	return unifiedDiff(fromName, toName, from, to)
+}
+
+/**
+* Git style unified diff of two texts, empty when same
+ */
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var buf strings.Builder
+	for start := 0; start < len(lines); {
+		// Next change, and the hunk around it until two changes are more than 2 * context lines apart
+		first := start
+		for first < len(lines) && ' ' == lines[first].Op {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		begin := first - diffContextLines
+		if begin < start {
+			begin = start
+		}
+		end := first
+		for same := 0; end < len(lines) && same <= 2*diffContextLines; end++ {
+			if ' ' == lines[end].Op {
+				same++
+			} else {
+				same = 0
+			}
+		}
+		// Trailing context
+		for end > first && ' ' == lines[end-1].Op {
+			end--
+		}
+		if end += diffContextLines; end > len(lines) {
+			end = len(lines)
+		}
+
+		if 0 == buf.Len() {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&buf, lines, begin, end)
+		start = end
+	}
+	return buf.String()
+}
+
+/**
+* @@ -l,s +l,s @@ header and the lines of the hunk
+ */
+func writeHunk(buf *strings.Builder, lines []diffLine, begin, end int) {
+	fromLine, toLine := 1, 1
+	for _, line := range lines[:begin] {
+		if '+' != line.Op {
+			fromLine++
+		}
+		if '-' != line.Op {
+			toLine++
+		}
+	}
+	fromCount, toCount := 0, 0
+	for _, line := range lines[begin:end] {
+		if '+' != line.Op {
+			fromCount++
+		}
+		if '-' != line.Op {
+			toCount++
+		}
+	}
+	if 0 == fromCount { // empty range starts at the line before
+		fromLine--
+	}
+	if 0 == toCount {
+		toLine--
+	}
+
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+	for _, line := range lines[begin:end] {
+		buf.WriteByte(line.Op)
+		buf.WriteString(line.Text + "\n")
+	}
+}
+
+/**
+* Edit script of the lines by longest common subsequence
+ */
+func diffLines(from, to []string) []diffLine {
+	// lcs[i][j]: common lines of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		if from[i] == to[j] {
+			lines = append(lines, diffLine{' ', from[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, diffLine{'-', from[i]})
+			i++
+		} else {
+			lines = append(lines, diffLine{'+', to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		lines = append(lines, diffLine{'-', from[i]})
+	}
+	for ; j < len(to); j++ {
+		lines = append(lines, diffLine{'+', to[j]})
+	}
+	return lines
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimRight(text, "\n")
+	if "" == text {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+/**
+* Color the lines of the unified diff, as git diff
+ */
+func colorDiff(diff string) string {
+	lines := strings.SplitAfter(diff, "\n")
+	for i, line := range lines {
+		text := strings.TrimSuffix(line, "\n")
+		if "" == text {
+			continue
+		}
+		color := ""
+		switch {
+		case strings.HasPrefix(text, "--- "), strings.HasPrefix(text, "+++ "):
+			color = colorBold
+		case strings.HasPrefix(text, "@@"):
+			color = colorCyan
+		case '-' == text[0]:
+			color = colorRed
+		case '+' == text[0]:
+			color = colorGreen
+		}
+		if "" != color {
+			lines[i] = color + text + colorReset + line[len(text):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+/**
+* Color by DiffColor, auto: the output is a terminal and NO_COLOR is not set
+ */
+func useDiffColor() bool {
+	switch globalSet.DiffColor {
+	case DiffColorAlways:
+		return true
+	case DiffColorNever:
+		return false
+	}
+	if _, has := os.LookupEnv("NO_COLOR"); has || "dumb" == os.Getenv("TERM") {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return nil == err && 0 != info.Mode()&os.ModeCharDevice
+}
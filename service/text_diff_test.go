@@ -0,0 +1,41 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTableDiffsForeignKeyCycle(t *testing.T) {
+	globalSet = &GlobalSet{TableDiff: true}
+	defer func() { gTableList = nil }()
+
+	for _, alterType := range []AlterType{alterTypeCreate, alterTypeDrop} {
+		plan := cyclePlan(alterType)
+		gTableList = make(map[string]*MySchema)
+		constraint := "-  CONSTRAINT `fk_a_b`"
+		if alterTypeCreate == alterType {
+			gTableList["a"], gTableList["b"] = ParseSchema(cycleSchemas["a"]), ParseSchema(cycleSchemas["b"])
+			constraint = "+  CONSTRAINT `fk_a_b`"
+		}
+
+		// One diff per table, with the foreign keys
+		r, w, _ := os.Pipe()
+		stdout := os.Stdout
+		os.Stdout = w
+		printTableDiffs("shop", plan)
+		os.Stdout = stdout
+		w.Close()
+		out, _ := ioutil.ReadAll(r)
+		if n := strings.Count(string(out), "CREATE TABLE `a`"); n != 1 || !strings.Contains(string(out), constraint) {
+			t.Errorf("%s diff of a printed %d times, want once with %s:\n%s", alterType, n, constraint, out)
+		}
+
+		for _, tr := range newTableRets("shop", plan, nil) {
+			if "a" == tr.Name && (tr.Type != alterType || !strings.Contains(tr.Diff, constraint)) {
+				t.Errorf("%s table result of a = %s %q", alterType, tr.Type, tr.Diff)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"struct_sync/logger"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -50,3 +51,17 @@ func maxMapKeyLen(data interface{}, ext int) string {
 func getSyncKey() string {
 	return time.Now().Format("20060102150405")
 }
+
+// Escape of the special characters in sql string, same as SHOW CREATE TABLE
+var sqlStringEscaper = strings.NewReplacer(`\`, `\\`, "'", "''", "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`)
+
+// Quote string value for sql, ex: it's -> 'it''s', C:\ -> 'C:\\'
+func quoteString(str string) string {
+	return "'" + sqlStringEscaper.Replace(str) + "'"
+}
+
+// Sort strings and return the slice
+func sortStrings(strs []string) []string {
+	sort.Strings(strs)
+	return strs
+}